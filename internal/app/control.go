@@ -13,6 +13,9 @@ import (
 	"time"
 
 	"github.com/nextmn/gnb-lite/internal/cli"
+	"github.com/nextmn/gnb-lite/internal/common"
+	"github.com/nextmn/gnb-lite/internal/gtp"
+	"github.com/nextmn/gnb-lite/internal/metrics"
 	"github.com/nextmn/gnb-lite/internal/radio"
 	"github.com/nextmn/gnb-lite/internal/session"
 
@@ -30,7 +33,7 @@ type HttpServerEntity struct {
 	closed chan struct{}
 }
 
-func NewHttpServerEntity(bindAddr netip.AddrPort, r *radio.Radio, ps *session.PduSessions) *HttpServerEntity {
+func NewHttpServerEntity(bindAddr netip.AddrPort, r *radio.Radio, ps *session.PduSessions, g *gtp.Gtp, procedures *common.Procedures, client *common.Client) *HttpServerEntity {
 	c := cli.NewCli(r, ps)
 	gin.SetMode(gin.ReleaseMode)
 	h := ginlogger.Default()
@@ -45,6 +48,18 @@ func NewHttpServerEntity(bindAddr netip.AddrPort, r *radio.Radio, ps *session.Pd
 	// Pdu Sessions
 	ps.Register(h)
 
+	// GTP
+	g.Register(h)
+
+	// Procedures
+	procedures.Register(h)
+
+	// Outbound messages
+	client.Register(h)
+
+	// Prometheus
+	metrics.Register(h)
+
 	logrus.WithFields(logrus.Fields{"http-addr": bindAddr}).Info("HTTP Server created")
 	e := HttpServerEntity{
 		srv: &http.Server{
@@ -0,0 +1,14 @@
+// Copyright Louis Royer and the NextMN contributors. All rights reserved.
+// Use of this source code is governed by a MIT-style license that can be
+// found in the LICENSE file.
+// SPDX-License-Identifier: MIT
+
+package app
+
+import (
+	"errors"
+)
+
+var (
+	ErrNoN3Address = errors.New("no N3 address: gtp or n3 must be set")
+)
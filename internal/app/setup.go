@@ -7,10 +7,13 @@ package app
 
 import (
 	"context"
+	"net/netip"
 	"time"
 
+	"github.com/nextmn/gnb-lite/internal/common"
 	"github.com/nextmn/gnb-lite/internal/config"
 	"github.com/nextmn/gnb-lite/internal/gtp"
+	"github.com/nextmn/gnb-lite/internal/metrics"
 	"github.com/nextmn/gnb-lite/internal/radio"
 	"github.com/nextmn/gnb-lite/internal/session"
 )
@@ -22,23 +25,171 @@ type Setup struct {
 	rDaemon          *radio.RadioDaemon
 	psMan            *session.PduSessionsManager
 	gtp              *gtp.Gtp
+	n3               []session.N3Address
+}
+
+func init() {
+	metrics.AddDropReason(session.ErrUnsupportedPDUType, "unsupported-pdu-type")
+	metrics.AddDropReason(session.ErrPduSessionNotFound, "pdu-session-not-found")
+	metrics.AddDropReason(radio.ErrUnknownUE, "unknown-ue")
+	metrics.AddDropReason(session.ErrBitRateExceeded, "bit-rate-exceeded")
+	metrics.AddDropReason(radio.ErrDownlinkBufferFull, "dl-buffer-full")
+	metrics.AddDropReason(radio.ErrDownlinkBufferAge, "dl-buffer-age")
+	metrics.AddDropReason(session.ErrHeldDownlinkFull, "held-dl-full")
+	metrics.AddDropReason(radio.ErrMalformedFrame, "malformed-radio-frame")
+	metrics.AddDropReason(radio.ErrUnknownFrameType, "malformed-radio-frame")
+	metrics.AddDropReason(common.ErrQueueFull, "queue-full")
+	metrics.AddDropReason(common.ErrPacketTooLarge, "packet-too-large")
 }
 
 func NewSetup(config *config.GNBConfig) *Setup {
-	r := radio.NewRadio(config.Control.Uri, config.Ran.BindAddr, "go-github-nextmn-gnb-lite")
-	psMan := session.NewPduSessionsManager(config.Gtp)
-	rDaemon := radio.NewRadioDaemon(r, psMan, config.Ran.BindAddr)
-	ps := session.NewPduSessions(config.Control.Uri, config.Cp.Uri, psMan, "go-github-nextmn-gnb-lite", config.Gtp)
+	var dlBufferSize int
+	var dlBufferMaxAge time.Duration
+	if config.Ran.DlBuffer != nil {
+		dlBufferSize = config.Ran.DlBuffer.Size
+		dlBufferMaxAge = config.Ran.DlBuffer.MaxAge
+	}
+	procedures := common.NewProcedures()
+	client := newClient(config.Outbound)
+	r := radio.NewRadio(config.Control.Uri, config.Ran.BindAddr, client, dlBufferSize, dlBufferMaxAge, procedures)
+	var forwardingTimeout time.Duration
+	if config.Handover != nil {
+		forwardingTimeout = config.Handover.ForwardingTimeout
+	}
+	var reflectiveQosTimer time.Duration
+	var qosFrames bool
+	if config.Qos != nil {
+		reflectiveQosTimer = config.Qos.ReflectiveQosTimer
+		qosFrames = config.Qos.RadioFrames
+	}
+	n3 := n3Addresses(config)
+	psMan := session.NewPduSessionsManager(n3, forwardingTimeout, reflectiveQosTimer)
+	if config.Qos != nil {
+		psMan.SetDefaultAmbr(bitRate(config.Qos.UeAmbr), bitRate(config.Qos.SessionAmbr))
+	}
+	var ulWorkers, dlWorkers, queueSize, n3Sockets, batchSize int
+	if config.Pipeline != nil {
+		ulWorkers = config.Pipeline.UplinkWorkers
+		dlWorkers = config.Pipeline.DownlinkWorkers
+		queueSize = config.Pipeline.QueueSize
+		n3Sockets = config.Pipeline.N3Sockets
+		batchSize = config.Pipeline.BatchSize
+	}
+	rDaemon := radio.NewRadioDaemon(r, psMan, config.Ran.BindAddr, ulWorkers, queueSize, batchSize)
+	psMan.SetDownlinkWriter(rDaemon)
+	psMan.OnUeContextRemoved(r.RemoveUe)
+	var gnbGtp netip.Addr
+	if len(n3) > 0 {
+		gnbGtp = n3[0].Addr
+	}
+	var procedureTimeout time.Duration
+	if config.Outbound != nil {
+		procedureTimeout = config.Outbound.ProcedureTimeout
+	}
+	ps := session.NewPduSessions(config.Control.Uri, config.Cp.Uri, psMan, client, gnbGtp, procedures, procedureTimeout)
+	var paths *gtp.PathManager
+	if config.GtpPath != nil {
+		paths = gtp.NewPathManager(psMan, config.GtpPath.EchoInterval, config.GtpPath.T3Response, config.GtpPath.N3Requests)
+	} else {
+		paths = gtp.NewPathManager(psMan, 0, 0, 0)
+	}
+	var errIndSend, errIndHandle bool
+	if config.ErrorInd != nil {
+		errIndSend = config.ErrorInd.Send
+		errIndHandle = config.ErrorInd.Handle
+	}
+	addrs := make([]netip.Addr, len(n3))
+	for i, a := range n3 {
+		addrs[i] = a.Addr
+	}
+	g := gtp.NewGtp(addrs, psMan, ps, rDaemon, paths, errIndSend, errIndHandle, qosFrames, dlWorkers, queueSize, n3Sockets, batchSize)
+	metrics.QueueLength(metrics.DIRECTION_UPLINK, rDaemon.UplinkQueueLen)
+	metrics.QueueLength(metrics.DIRECTION_DOWNLINK, g.DownlinkQueueLen)
 	return &Setup{
 		config:           config,
-		httpServerEntity: NewHttpServerEntity(config.Control.BindAddr, r, ps),
+		httpServerEntity: NewHttpServerEntity(config.Control.BindAddr, r, ps, g, procedures, client),
 		radio:            r,
 		rDaemon:          rDaemon,
 		psMan:            psMan,
-		gtp:              gtp.NewGtp(config.Gtp, psMan, rDaemon),
+		gtp:              g,
+		n3:               n3,
+	}
+}
+
+// Converts N3 addresses from the configuration file: the gtp address comes first, without selection rules
+func n3Addresses(conf *config.GNBConfig) []session.N3Address {
+	res := make([]session.N3Address, 0, len(conf.N3)+1)
+	if conf.Gtp.IsValid() {
+		res = append(res, session.N3Address{Addr: conf.Gtp})
+	}
+	for _, a := range conf.N3 {
+		if a.Addr == conf.Gtp {
+			continue
+		}
+		n3 := session.N3Address{
+			Addr: a.Addr,
+			Upfs: a.Upfs,
+			Dnns: a.Dnns,
+		}
+		for _, s := range a.Slices {
+			n3.Slices = append(n3.Slices, session.Snssai{Sst: s.Sst, Sd: s.Sd})
+		}
+		res = append(res, n3)
+	}
+	return res
+}
+
+// Creates the client used for outbound messages
+func newClient(outbound *config.Outbound) *common.Client {
+	if outbound == nil {
+		return common.NewClient("go-github-nextmn-gnb-lite", 0, common.DEFAULT_CLIENT_RETRIES, 0, 0)
+	}
+	retries := common.DEFAULT_CLIENT_RETRIES
+	if outbound.Retries != nil {
+		retries = *outbound.Retries
 	}
+	return common.NewClient("go-github-nextmn-gnb-lite", outbound.Timeout, retries, outbound.Backoff, outbound.MaxBackoff)
 }
+
+// Converts a bit rate from the configuration file
+func bitRate(rate *config.BitRate) *session.BitRate {
+	if rate == nil {
+		return nil
+	}
+	return &session.BitRate{Uplink: rate.Uplink, Downlink: rate.Downlink}
+}
+
+// Converts radio channel parameters from the configuration file
+func channelParams(params *config.ChannelParams) radio.ChannelParams {
+	res := radio.ChannelParams{
+		Loss:    params.Loss,
+		Delay:   radio.Duration(params.Delay),
+		Jitter:  radio.Duration(params.Jitter),
+		Reorder: params.Reorder,
+		Rate:    params.Rate,
+	}
+	if ge := params.GilbertElliott; ge != nil {
+		res.GilbertElliott = &radio.GilbertElliott{P: ge.P, R: ge.R, LossGood: ge.LossGood, LossBad: ge.LossBad}
+	}
+	return res
+}
+
 func (s *Setup) Init(ctx context.Context) error {
+	if len(s.n3) == 0 {
+		return ErrNoN3Address
+	}
+	if channel := s.config.Ran.Channel; channel != nil {
+		if channel.Uplink != nil {
+			if err := s.radio.Channels.SetDefault(radio.DirectionUplink, channelParams(channel.Uplink)); err != nil {
+				return err
+			}
+		}
+		if channel.Downlink != nil {
+			if err := s.radio.Channels.SetDefault(radio.DirectionDownlink, channelParams(channel.Downlink)); err != nil {
+				return err
+			}
+		}
+	}
 	return nil
 }
 
@@ -62,12 +213,16 @@ func (s *Setup) Run(ctx context.Context) error {
 		s.waitShutdown(ctxShutdown)
 	}()
 
-	if err := s.rDaemon.Start(ctx); err != nil {
+	if err := s.Init(ctx); err != nil {
 		return err
 	}
+	// N3 sockets are used to send uplink traffic: GTP-U is started first
 	if err := s.gtp.Start(ctx); err != nil {
 		return err
 	}
+	if err := s.rDaemon.Start(ctx); err != nil {
+		return err
+	}
 	if err := s.httpServerEntity.Start(ctx); err != nil {
 		return err
 	}
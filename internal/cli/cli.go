@@ -26,4 +26,5 @@ func NewCli(r *radio.Radio, p *session.PduSessions) *Cli {
 
 func (cli *Cli) Register(e *gin.Engine) {
 	e.POST("/cli/ps/handover", cli.PsHandover)
+	e.POST("/cli/ps/handover-cancel", cli.PsHandoverCancel)
 }
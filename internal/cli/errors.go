@@ -0,0 +1,14 @@
+// Copyright Louis Royer and the NextMN contributors. All rights reserved.
+// Use of this source code is governed by a MIT-style license that can be
+// found in the LICENSE file.
+// SPDX-License-Identifier: MIT
+
+package cli
+
+import (
+	"errors"
+)
+
+var (
+	ErrUnknownHandoverType = errors.New("unknown handover type")
+)
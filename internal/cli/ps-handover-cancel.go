@@ -0,0 +1,51 @@
+// Copyright Louis Royer and the NextMN contributors. All rights reserved.
+// Use of this source code is governed by a MIT-style license that can be
+// found in the LICENSE file.
+// SPDX-License-Identifier: MIT
+
+package cli
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/nextmn/gnb-lite/internal/session"
+
+	"github.com/nextmn/json-api/jsonapi"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+type PsHandoverCancel struct {
+	UeCtrl    jsonapi.ControlURI `json:"ue-ctrl"`
+	GNBTarget jsonapi.ControlURI `json:"gnb-target"`
+	Type      HandoverType       `json:"type,omitempty"` // type of the handover to cancel
+	Cause     string             `json:"cause,omitempty"`
+}
+
+func (cli *Cli) PsHandoverCancel(c *gin.Context) {
+	var ps PsHandoverCancel
+	if err := c.BindJSON(&ps); err != nil {
+		logrus.WithError(err).Error("could not deserialize")
+		c.JSON(http.StatusBadRequest, jsonapi.MessageWithError{Message: "could not deserialize", Error: err})
+		return
+	}
+	var xn bool
+	switch ps.Type {
+	case "", HandoverTypeN2:
+	case HandoverTypeXn:
+		xn = true
+	default:
+		c.JSON(http.StatusBadRequest, jsonapi.MessageWithError{Message: "unknown handover type", Error: ErrUnknownHandoverType})
+		return
+	}
+	cause := ps.Cause
+	if cause == "" {
+		cause = "cancelled by user"
+	}
+	cli.PduSessions.StartProcedure(c, ps.UeCtrl, session.ProcHandoverCancellation, func(ctx context.Context, _ session.UeState) (session.UeState, error) {
+		cli.PduSessions.CancelHandover(ctx, ps.UeCtrl, ps.GNBTarget, xn, cause)
+		return session.UeStateConnected, nil
+	})
+}
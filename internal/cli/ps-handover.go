@@ -6,22 +6,30 @@
 package cli
 
 import (
-	"bytes"
-	"encoding/json"
+	"context"
 	"net/http"
 
+	"github.com/nextmn/gnb-lite/internal/session"
+
 	"github.com/nextmn/json-api/jsonapi"
-	"github.com/nextmn/json-api/jsonapi/n1n2"
 
 	"github.com/gin-gonic/gin"
 	"github.com/sirupsen/logrus"
 )
 
+type HandoverType string
+
+const (
+	HandoverTypeN2 HandoverType = "n2" // default
+	HandoverTypeXn HandoverType = "xn"
+)
+
 type PsHandover struct {
 	UeCtrl             jsonapi.ControlURI `json:"ue-ctrl"`
 	GNBTarget          jsonapi.ControlURI `json:"gnb-target"`
-	Sessions           []n1n2.Session     `json:"sessions"`
+	Sessions           []session.Session  `json:"sessions"` // when empty, every PDU Session of the UE is moved
 	IndirectForwarding bool               `json:"indirect-forwarding"`
+	Type               HandoverType       `json:"type,omitempty"` // Xn handover: DL traffic is forwarded directly to the target gNB
 }
 
 func (cli *Cli) PsHandover(c *gin.Context) {
@@ -29,37 +37,64 @@ func (cli *Cli) PsHandover(c *gin.Context) {
 	if err := c.BindJSON(&ps); err != nil {
 		logrus.WithError(err).Error("could not deserialize")
 		c.JSON(http.StatusBadRequest, jsonapi.MessageWithError{Message: "could not deserialize", Error: err})
+		return
 	}
-	go cli.HandlePsHandover(ps)
-	c.JSON(http.StatusAccepted, jsonapi.Message{Message: "please refer to logs for more information"})
+	handle := cli.HandlePsHandover
+	switch ps.Type {
+	case "", HandoverTypeN2:
+	case HandoverTypeXn:
+		handle = cli.HandlePsXnHandover
+	default:
+		c.JSON(http.StatusBadRequest, jsonapi.MessageWithError{Message: "unknown handover type", Error: ErrUnknownHandoverType})
+		return
+	}
+	cli.PduSessions.StartProcedure(c, ps.UeCtrl, session.ProcHandover, func(ctx context.Context, _ session.UeState) (session.UeState, error) {
+		if err := handle(ctx, ps); err != nil {
+			return "", err
+		}
+		return session.UeStateHandoverPreparing, nil
+	})
 }
 
-func (cli *Cli) HandlePsHandover(ps PsHandover) {
-	ctx := cli.PduSessions.Context()
-	hr := n1n2.HandoverRequired{
+func (cli *Cli) HandlePsHandover(ctx context.Context, ps PsHandover) error {
+	sessions := ps.Sessions
+	if len(sessions) == 0 {
+		sessions = cli.PduSessions.UeSessions(ps.UeCtrl)
+	}
+	hr := session.HandoverRequired{
 		// Header
 		SourcegNB: cli.PduSessions.Control,
 		Cp:        cli.PduSessions.Cp,
 		// Handover Required
 		Ue:                 ps.UeCtrl,
-		Sessions:           ps.Sessions,
+		Sessions:           sessions,
 		TargetgNB:          ps.GNBTarget,
 		IndirectForwarding: ps.IndirectForwarding,
 	}
-	reqBody, err := json.Marshal(hr)
-	if err != nil {
-		logrus.WithError(err).Error("Could not marshal n1n2.HandoverRequired")
-		return
+	if err := cli.PduSessions.Client.Post(ctx, cli.PduSessions.Cp, "ps/handover-required", hr); err != nil {
+		logrus.WithError(err).Error("Could not send ps/handover-required")
+		return err
 	}
-	req, err := http.NewRequestWithContext(ctx, http.MethodPost, cli.PduSessions.Cp.JoinPath("ps/handover-required").String(), bytes.NewBuffer(reqBody))
-	if err != nil {
-		logrus.WithError(err).Error("Could not create ps/handover-required")
-		return
+	return nil
+}
+
+func (cli *Cli) HandlePsXnHandover(ctx context.Context, ps PsHandover) error {
+	sessions := ps.Sessions
+	if len(sessions) == 0 {
+		sessions = cli.PduSessions.UeSessions(ps.UeCtrl)
 	}
-	req.Header.Set("User-Agent", cli.PduSessions.UserAgent)
-	req.Header.Set("Content-Type", "application/json; charset=UTF-8")
-	if _, err := cli.PduSessions.Client.Do(req); err != nil {
-		logrus.WithError(err).Error("Could not send ps/handover-required")
-		return
+	hr := session.XnHandoverRequest{
+		// Header
+		UeCtrl:    ps.UeCtrl,
+		Cp:        cli.PduSessions.Cp,
+		SourcegNB: cli.PduSessions.Control,
+		// Xn Handover Request
+		TargetgNB: ps.GNBTarget,
+		Sessions:  sessions,
+	}
+	if err := cli.PduSessions.Client.Post(ctx, ps.GNBTarget, "xn/handover-request", hr); err != nil {
+		logrus.WithError(err).Error("Could not send xn/handover-request")
+		return err
 	}
+	return nil
 }
@@ -0,0 +1,35 @@
+// Copyright Louis Royer and the NextMN contributors. All rights reserved.
+// Use of this source code is governed by a MIT-style license that can be
+// found in the LICENSE file.
+// SPDX-License-Identifier: MIT
+
+package common
+
+import (
+	"sync"
+)
+
+// Pool of fixed-size packet buffers, to avoid an allocation per received packet
+type BufferPool struct {
+	pool sync.Pool
+}
+
+func NewBufferPool(size int) *BufferPool {
+	return &BufferPool{
+		pool: sync.Pool{
+			New: func() any {
+				buf := make([]byte, size)
+				return &buf
+			},
+		},
+	}
+}
+
+func (p *BufferPool) Get() *[]byte {
+	return p.pool.Get().(*[]byte)
+}
+
+// The buffer must not be used after being put back in the pool
+func (p *BufferPool) Put(buf *[]byte) {
+	p.pool.Put(buf)
+}
@@ -0,0 +1,199 @@
+// Copyright Louis Royer and the NextMN contributors. All rights reserved.
+// Use of this source code is governed by a MIT-style license that can be
+// found in the LICENSE file.
+// SPDX-License-Identifier: MIT
+
+package common
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/nextmn/json-api/jsonapi"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	DEFAULT_CLIENT_TIMEOUT     = 5 * time.Second // per attempt
+	DEFAULT_CLIENT_RETRIES     = 3
+	DEFAULT_CLIENT_BACKOFF     = 100 * time.Millisecond // doubled after each attempt
+	DEFAULT_CLIENT_MAX_BACKOFF = 2 * time.Second
+)
+
+// Metrics of messages sent to a destination (control URI of a UE, gNB, or CP)
+type ClientMetrics struct {
+	Messages    uint64         `json:"messages"`
+	Attempts    uint64         `json:"attempts"`
+	Succeeded   uint64         `json:"succeeded"`
+	Failed      uint64         `json:"failed"` // after the last attempt
+	Status      map[int]uint64 `json:"status"` // HTTP status code: number of responses
+	LastError   string         `json:"last-error,omitempty"`
+	LastErrorAt time.Time      `json:"last-error-at,omitzero"`
+}
+
+// Client sends messages to the control API of UEs, gNBs, and the CP.
+// Messages are retried (with exponential backoff) only when they have not been processed by the peer:
+// when the connection could not be established, and on 503 and 429 status codes.
+// Timeouts and other errors are not retried, since messages are not idempotent.
+type Client struct {
+	http       http.Client
+	userAgent  string
+	retries    int
+	backoff    time.Duration
+	maxBackoff time.Duration
+
+	sync.Mutex
+	metrics map[string]*ClientMetrics // destination: metrics
+}
+
+func NewClient(userAgent string, timeout time.Duration, retries int, backoff time.Duration, maxBackoff time.Duration) *Client {
+	if timeout <= 0 {
+		timeout = DEFAULT_CLIENT_TIMEOUT
+	}
+	if retries < 0 {
+		retries = DEFAULT_CLIENT_RETRIES
+	}
+	if backoff <= 0 {
+		backoff = DEFAULT_CLIENT_BACKOFF
+	}
+	if maxBackoff <= 0 {
+		maxBackoff = DEFAULT_CLIENT_MAX_BACKOFF
+	}
+	return &Client{
+		http:       http.Client{Timeout: timeout},
+		userAgent:  userAgent,
+		retries:    retries,
+		backoff:    backoff,
+		maxBackoff: maxBackoff,
+		metrics:    make(map[string]*ClientMetrics),
+	}
+}
+
+func (c *Client) UserAgent() string {
+	return c.userAgent
+}
+
+// Warning: not thread safe
+func (c *Client) destination(peer jsonapi.ControlURI) *ClientMetrics {
+	m, ok := c.metrics[peer.String()]
+	if !ok {
+		m = &ClientMetrics{Status: make(map[int]uint64)}
+		c.metrics[peer.String()] = m
+	}
+	return m
+}
+
+// Records a message for which no attempt succeeded
+func (c *Client) fail(peer jsonapi.ControlURI, err error) {
+	c.Lock()
+	defer c.Unlock()
+	m := c.destination(peer)
+	m.Failed++
+	m.LastError = err.Error()
+	m.LastErrorAt = time.Now()
+}
+
+// Sends msg as JSON to the control API of peer, and returns an error if no attempt succeeded
+func (c *Client) Post(ctx context.Context, peer jsonapi.ControlURI, path string, msg any) error {
+	body, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	uri := peer.JoinPath(path).String()
+	c.Lock()
+	c.destination(peer).Messages++
+	c.Unlock()
+
+	backoff := c.backoff
+	for attempt := 0; ; attempt++ {
+		retry, err := c.post(ctx, peer, uri, body)
+		if err == nil {
+			c.Lock()
+			c.destination(peer).Succeeded++
+			c.Unlock()
+			return nil
+		}
+		if !retry || attempt >= c.retries {
+			c.fail(peer, err)
+			return err
+		}
+		logrus.WithError(err).WithFields(logrus.Fields{
+			"uri":     uri,
+			"attempt": attempt + 1,
+			"backoff": backoff,
+		}).Debug("Retrying message")
+		select {
+		case <-ctx.Done():
+			c.fail(peer, err)
+			return ctx.Err()
+		case <-time.After(backoff):
+		}
+		backoff = min(2*backoff, c.maxBackoff)
+	}
+}
+
+// Single attempt; returns true when the error is transient
+func (c *Client) post(ctx context.Context, peer jsonapi.ControlURI, uri string, body []byte) (bool, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, uri, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("User-Agent", c.userAgent)
+	req.Header.Set("Content-Type", "application/json; charset=UTF-8")
+	c.Lock()
+	c.destination(peer).Attempts++
+	c.Unlock()
+	resp, err := c.http.Do(req)
+	if err != nil {
+		// the request has not been sent when dialing failed (e.g. connection refused)
+		var opErr *net.OpError
+		return ctx.Err() == nil && errors.As(err, &opErr) && opErr.Op == "dial", err
+	}
+	// body is drained to allow reuse of the connection
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+	c.Lock()
+	c.destination(peer).Status[resp.StatusCode]++
+	c.Unlock()
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return false, nil
+	}
+	err = fmt.Errorf("%w: %s", ErrUnexpectedStatus, resp.Status)
+	return resp.StatusCode == http.StatusServiceUnavailable || resp.StatusCode == http.StatusTooManyRequests, err
+}
+
+// Returns a copy of metrics of every destination
+func (c *Client) Metrics() map[string]ClientMetrics {
+	c.Lock()
+	defer c.Unlock()
+	res := make(map[string]ClientMetrics, len(c.metrics))
+	for dest, m := range c.metrics {
+		cp := *m
+		cp.Status = make(map[int]uint64, len(m.Status))
+		for code, n := range m.Status {
+			cp.Status[code] = n
+		}
+		res[dest] = cp
+	}
+	return res
+}
+
+// get metrics of outbound messages
+func (c *Client) Status(ctx *gin.Context) {
+	ctx.Header("Cache-Control", "no-cache")
+	ctx.JSON(http.StatusOK, c.Metrics())
+}
+
+func (c *Client) Register(e *gin.Engine) {
+	e.GET("/client", c.Status)
+}
@@ -10,5 +10,9 @@ import (
 )
 
 var (
-	ErrNilCtx = errors.New("nil context")
+	ErrNilCtx               = errors.New("nil context")
+	ErrUnexpectedStatus     = errors.New("unexpected HTTP status")
+	ErrQueueFull            = errors.New("queue full")
+	ErrPacketTooLarge       = errors.New("packet too large")
+	ErrReusePortUnsupported = errors.New("SO_REUSEPORT is not supported on this platform")
 )
@@ -0,0 +1,209 @@
+// Copyright Louis Royer and the NextMN contributors. All rights reserved.
+// Use of this source code is governed by a MIT-style license that can be
+// found in the LICENSE file.
+// SPDX-License-Identifier: MIT
+
+package common
+
+import (
+	"context"
+	"net"
+	"net/netip"
+
+	"github.com/nextmn/gnb-lite/internal/metrics"
+
+	"github.com/sirupsen/logrus"
+	"golang.org/x/net/ipv4"
+	"golang.org/x/net/ipv6"
+)
+
+const (
+	TX_BUFFER_SIZE = 2048 // larger packets are sent using a dedicated buffer
+	// Largest datagram read: Ethernet frame (1518 bytes with a VLAN tag) with GTP-U (and extension headers) or radio frame header.
+	// Buffers used for reading must be at least one byte larger, so larger datagrams can be detected and dropped.
+	MAX_PACKET_SIZE = 2048
+)
+
+// Returns a pool of buffers to read datagrams of up to MAX_PACKET_SIZE bytes
+func NewRxBufferPool() *BufferPool {
+	return NewBufferPool(MAX_PACKET_SIZE + 1)
+}
+
+// Implemented by both ipv4.PacketConn and ipv6.PacketConn (recvmmsg/sendmmsg on Linux)
+type batchConn interface {
+	ReadBatch(ms []ipv4.Message, flags int) (int, error)
+	WriteBatch(ms []ipv4.Message, flags int) (int, error)
+}
+
+type outPacket struct {
+	buf    *[]byte
+	n      int
+	addr   netip.AddrPort
+	pooled bool
+}
+
+// UDP socket used for user plane packets, with optional batched I/O:
+// up to batchSize packets are read or written with a single syscall.
+// UDP GSO/GRO (UDP_SEGMENT, UDP_GRO) is not used: each packet of a batch is a distinct datagram.
+type PacketConn struct {
+	*net.UDPConn
+	batch     batchConn // nil when batched I/O is disabled
+	batchSize int
+	out       chan outPacket
+	buffers   *BufferPool // for packets waiting to be written
+}
+
+// Batched I/O is disabled when batchSize is lower than 2
+func NewPacketConn(conn *net.UDPConn, batchSize int) *PacketConn {
+	c := &PacketConn{
+		UDPConn:   conn,
+		batchSize: batchSize,
+	}
+	if batchSize < 2 {
+		return c
+	}
+	if addr, ok := conn.LocalAddr().(*net.UDPAddr); ok && addr.IP.To4() == nil {
+		c.batch = ipv6.NewPacketConn(conn)
+	} else {
+		c.batch = ipv4.NewPacketConn(conn)
+	}
+	c.out = make(chan outPacket, DEFAULT_QUEUE_SIZE)
+	c.buffers = NewBufferPool(TX_BUFFER_SIZE)
+	return c
+}
+
+// Writes queued packets until ctx is done (batched I/O only)
+func (c *PacketConn) Run(ctx context.Context) {
+	if c.batch == nil {
+		return
+	}
+	msgs := make([]ipv4.Message, c.batchSize)
+	pending := make([]outPacket, 0, c.batchSize)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case pkt := <-c.out:
+			pending = append(pending, pkt)
+		}
+	collect:
+		for len(pending) < c.batchSize {
+			select {
+			case pkt := <-c.out:
+				pending = append(pending, pkt)
+			default:
+				break collect
+			}
+		}
+		for i, pkt := range pending {
+			msgs[i].Buffers = [][]byte{(*pkt.buf)[:pkt.n]}
+			msgs[i].Addr = net.UDPAddrFromAddrPort(pkt.addr)
+		}
+		for sent := 0; sent < len(pending); {
+			n, err := c.batch.WriteBatch(msgs[sent:len(pending)], 0)
+			if err != nil {
+				logrus.WithError(err).Trace("Could not write packets")
+				metrics.Drop(err)
+				// skip the packet that could not be sent
+				n++
+			}
+			sent += n
+		}
+		for i, pkt := range pending {
+			if pkt.pooled {
+				c.buffers.Put(pkt.buf)
+			}
+			msgs[i] = ipv4.Message{}
+		}
+		pending = pending[:0]
+	}
+}
+
+// With batched I/O, the packet is copied and queued: errors are only logged
+func (c *PacketConn) WriteToUDPAddrPort(b []byte, addr netip.AddrPort) (int, error) {
+	if c.batch == nil {
+		return c.UDPConn.WriteToUDPAddrPort(b, addr)
+	}
+	pkt := outPacket{addr: addr, pooled: len(b) <= TX_BUFFER_SIZE}
+	if pkt.pooled {
+		pkt.buf = c.buffers.Get()
+	} else {
+		buf := make([]byte, len(b))
+		pkt.buf = &buf
+	}
+	pkt.n = copy(*pkt.buf, b)
+	select {
+	case c.out <- pkt:
+		return pkt.n, nil
+	default:
+		if pkt.pooled {
+			c.buffers.Put(pkt.buf)
+		}
+		return 0, ErrQueueFull
+	}
+}
+
+// Returns true if the datagram filled the whole buffer: it may have been truncated, and is dropped
+func tooLarge(buf []byte, n int, addr netip.AddrPort) bool {
+	if n < len(buf) {
+		return false
+	}
+	logrus.WithFields(logrus.Fields{
+		"peer": addr,
+	}).Trace("Datagram too large: dropping packet")
+	metrics.Drop(ErrPacketTooLarge)
+	return true
+}
+
+// Reads packets until an error occurs: handle takes ownership of buffers got from the pool.
+// Datagrams filling a whole buffer are dropped (see NewRxBufferPool).
+func (c *PacketConn) ReadPackets(buffers *BufferPool, handle func(buf *[]byte, n int, addr netip.AddrPort)) error {
+	if c.batch == nil {
+		for {
+			buf := buffers.Get()
+			n, addr, err := c.ReadFromUDPAddrPort(*buf)
+			if err != nil {
+				buffers.Put(buf)
+				return err
+			}
+			if tooLarge(*buf, n, addr) {
+				buffers.Put(buf)
+				continue
+			}
+			handle(buf, n, netip.AddrPortFrom(addr.Addr().Unmap(), addr.Port()))
+		}
+	}
+	msgs := make([]ipv4.Message, c.batchSize)
+	bufs := make([]*[]byte, c.batchSize)
+	defer func() {
+		for _, buf := range bufs {
+			if buf != nil {
+				buffers.Put(buf)
+			}
+		}
+	}()
+	for {
+		for i := range msgs {
+			if bufs[i] == nil {
+				bufs[i] = buffers.Get()
+				msgs[i].Buffers = [][]byte{*bufs[i]}
+			}
+		}
+		n, err := c.batch.ReadBatch(msgs, 0)
+		if err != nil {
+			return err
+		}
+		for i := range n {
+			udpAddr, ok := msgs[i].Addr.(*net.UDPAddr)
+			if !ok {
+				continue // buffer is reused
+			}
+			addr := udpAddr.AddrPort()
+			if tooLarge(*bufs[i], msgs[i].N, addr) {
+				continue // buffer is reused
+			}
+			handle(bufs[i], msgs[i].N, netip.AddrPortFrom(addr.Addr().Unmap(), addr.Port()))
+			bufs[i] = nil
+		}
+	}
+}
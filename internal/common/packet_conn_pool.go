@@ -0,0 +1,67 @@
+// Copyright Louis Royer and the NextMN contributors. All rights reserved.
+// Use of this source code is governed by a MIT-style license that can be
+// found in the LICENSE file.
+// SPDX-License-Identifier: MIT
+
+package common
+
+import (
+	"context"
+	"hash/maphash"
+	"net"
+	"net/netip"
+)
+
+// UDP sockets bound to the same address (SO_REUSEPORT when there are several sockets).
+// Packets to a given peer are always written on the same socket, so they are not reordered.
+type PacketConnPool struct {
+	conns []*PacketConn
+	seed  maphash.Seed
+}
+
+// Opens count sockets (at least one) bound to laddr
+func ListenPacketConnPool(ctx context.Context, laddr netip.AddrPort, count int, batchSize int) (*PacketConnPool, error) {
+	count = max(count, 1)
+	lc := net.ListenConfig{}
+	if count > 1 {
+		lc.Control = reusePort
+	}
+	pool := &PacketConnPool{
+		conns: make([]*PacketConn, 0, count),
+		seed:  maphash.MakeSeed(),
+	}
+	for range count {
+		conn, err := lc.ListenPacket(ctx, "udp", laddr.String())
+		if err != nil {
+			pool.Close()
+			return nil, err
+		}
+		pool.conns = append(pool.conns, NewPacketConn(conn.(*net.UDPConn), batchSize))
+	}
+	return pool, nil
+}
+
+func (p *PacketConnPool) Conns() []*PacketConn {
+	return p.conns
+}
+
+// Writes queued packets until ctx is done (batched I/O only)
+func (p *PacketConnPool) Run(ctx context.Context) {
+	for _, conn := range p.conns {
+		go conn.Run(ctx)
+	}
+}
+
+func (p *PacketConnPool) WriteToUDPAddrPort(b []byte, addr netip.AddrPort) (int, error) {
+	return p.conns[maphash.Comparable(p.seed, addr)%uint64(len(p.conns))].WriteToUDPAddrPort(b, addr)
+}
+
+func (p *PacketConnPool) Close() error {
+	var err error
+	for _, conn := range p.conns {
+		if e := conn.Close(); e != nil {
+			err = e
+		}
+	}
+	return err
+}
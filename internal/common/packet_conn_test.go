@@ -0,0 +1,143 @@
+// Copyright Louis Royer and the NextMN contributors. All rights reserved.
+// Use of this source code is governed by a MIT-style license that can be
+// found in the LICENSE file.
+// SPDX-License-Identifier: MIT
+
+package common
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"runtime"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/net/ipv4"
+)
+
+const (
+	BENCHMARK_PACKET_SIZE = 1400
+	BENCHMARK_RCVBUF      = 4 << 20 // capped by net.core.rmem_max
+	BENCHMARK_READ_BURST  = 256     // packets waiting in the receive buffer before each read burst
+)
+
+func listenLoopback(b *testing.B) *net.UDPConn {
+	b.Helper()
+	conn, err := net.ListenUDP("udp4", net.UDPAddrFromAddrPort(netip.MustParseAddrPort("127.0.0.1:0")))
+	if err != nil {
+		b.Fatal(err)
+	}
+	return conn
+}
+
+func localAddrPort(conn *net.UDPConn) netip.AddrPort {
+	return conn.LocalAddr().(*net.UDPAddr).AddrPort()
+}
+
+// Compares packets per second with and without batched I/O (recvmmsg/sendmmsg) over loopback.
+// Only the measured side runs while the timer is on: packets written are not read, and packets read
+// have been sent before the timer is started.
+// Run with: go test -run '^$' -bench BenchmarkPacketConn ./internal/common
+func BenchmarkPacketConn(b *testing.B) {
+	for _, batchSize := range []int{1, 32} {
+		b.Run(fmt.Sprintf("write/batch-size-%d", batchSize), func(b *testing.B) {
+			benchmarkWrite(b, batchSize)
+		})
+		b.Run(fmt.Sprintf("read/batch-size-%d", batchSize), func(b *testing.B) {
+			benchmarkRead(b, batchSize)
+		})
+	}
+}
+
+func benchmarkWrite(b *testing.B, batchSize int) {
+	// packets are dropped once the receive buffer is full
+	receiver := listenLoopback(b)
+	defer receiver.Close()
+	c := NewPacketConn(listenLoopback(b), batchSize)
+	defer c.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	var wg sync.WaitGroup
+	wg.Go(func() { c.Run(ctx) })
+	defer wg.Wait()
+	defer cancel()
+
+	pkt := make([]byte, BENCHMARK_PACKET_SIZE)
+	raddr := localAddrPort(receiver)
+	b.SetBytes(BENCHMARK_PACKET_SIZE)
+	b.ResetTimer()
+	for range b.N {
+		for {
+			_, err := c.WriteToUDPAddrPort(pkt, raddr)
+			if err == nil {
+				break
+			}
+			if !errors.Is(err, ErrQueueFull) {
+				b.Fatal(err)
+			}
+			runtime.Gosched()
+		}
+	}
+	// queued packets are written
+	for len(c.out) > 0 {
+		runtime.Gosched()
+	}
+	b.StopTimer()
+	b.ReportMetric(float64(b.N)/b.Elapsed().Seconds(), "pkts/s")
+}
+
+func benchmarkRead(b *testing.B, batchSize int) {
+	c := NewPacketConn(listenLoopback(b), batchSize)
+	defer c.Close()
+	if err := c.SetReadBuffer(BENCHMARK_RCVBUF); err != nil {
+		b.Fatal(err)
+	}
+	raddr := net.UDPAddrFromAddrPort(localAddrPort(c.UDPConn))
+	sender := listenLoopback(b)
+	defer sender.Close()
+	batch := ipv4.NewPacketConn(sender)
+	pkt := make([]byte, BENCHMARK_PACKET_SIZE)
+	msgs := make([]ipv4.Message, BENCHMARK_READ_BURST)
+	for i := range msgs {
+		msgs[i].Buffers = [][]byte{pkt}
+		msgs[i].Addr = raddr
+	}
+	fill := func(n int) {
+		for sent := 0; sent < n; {
+			k, err := batch.WriteBatch(msgs[:n-sent], 0)
+			if err != nil {
+				b.Fatal(err)
+			}
+			sent += k
+		}
+		// a lost packet ends the benchmark with a timeout instead of blocking
+		c.SetReadDeadline(time.Now().Add(time.Second))
+	}
+
+	buffers := NewBufferPool(TX_BUFFER_SIZE)
+	received := 0
+	b.SetBytes(BENCHMARK_PACKET_SIZE)
+	fill(min(b.N, BENCHMARK_READ_BURST))
+	b.ResetTimer()
+	err := c.ReadPackets(buffers, func(buf *[]byte, n int, addr netip.AddrPort) {
+		buffers.Put(buf)
+		received++
+		if received == b.N {
+			b.StopTimer()
+			c.Close() // ReadPackets returns
+			return
+		}
+		if received%BENCHMARK_READ_BURST == 0 {
+			b.StopTimer()
+			fill(min(b.N-received, BENCHMARK_READ_BURST))
+			b.StartTimer()
+		}
+	})
+	if received < b.N {
+		b.Fatalf("%d packets received out of %d (is net.core.rmem_max too low?): %v", received, b.N, err)
+	}
+	b.ReportMetric(float64(b.N)/b.Elapsed().Seconds(), "pkts/s")
+}
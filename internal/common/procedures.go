@@ -0,0 +1,169 @@
+// Copyright Louis Royer and the NextMN contributors. All rights reserved.
+// Use of this source code is governed by a MIT-style license that can be
+// found in the LICENSE file.
+// SPDX-License-Identifier: MIT
+
+package common
+
+import (
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/nextmn/gnb-lite/internal/metrics"
+
+	"github.com/nextmn/json-api/jsonapi"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+// Maximum number of finished procedures kept for status queries
+const MAX_PROCEDURES_HISTORY = 1024
+
+type ProcedureResult string
+
+const (
+	ProcedurePending   ProcedureResult = "pending"
+	ProcedureSucceeded ProcedureResult = "succeeded"
+	ProcedureFailed    ProcedureResult = "failed"
+)
+
+type ProcedureStatus struct {
+	Id         uint64             `json:"id"`
+	Procedure  string             `json:"procedure"`
+	Ue         jsonapi.ControlURI `json:"ue"`
+	Status     ProcedureResult    `json:"status"`
+	CreatedAt  time.Time          `json:"created-at"`
+	FinishedAt time.Time          `json:"finished-at,omitzero"`
+	Error      string             `json:"error,omitempty"`
+}
+
+// Answer to a control API call starting a procedure
+type ProcedureAccepted struct {
+	Message     string `json:"message"`
+	ProcedureId uint64 `json:"procedure-id"`
+}
+
+type trackedProcedure struct {
+	status ProcedureStatus
+	done   chan struct{} // closed when the procedure is finished
+}
+
+// Procedures keeps the status of procedures started by calls to the control API
+type Procedures struct {
+	sync.Mutex
+	lastId     uint64
+	procedures map[uint64]*trackedProcedure
+	order      []uint64 // ids, oldest first
+}
+
+func NewProcedures() *Procedures {
+	return &Procedures{
+		procedures: make(map[uint64]*trackedProcedure),
+	}
+}
+
+func (p *Procedures) add(ue jsonapi.ControlURI, name string) *trackedProcedure {
+	p.Lock()
+	defer p.Unlock()
+	p.lastId++
+	t := &trackedProcedure{
+		status: ProcedureStatus{
+			Id:        p.lastId,
+			Procedure: name,
+			Ue:        ue,
+			Status:    ProcedurePending,
+			CreatedAt: time.Now(),
+		},
+		done: make(chan struct{}),
+	}
+	p.procedures[t.status.Id] = t
+	p.order = append(p.order, t.status.Id)
+	// forget oldest finished procedures (pending procedures are kept)
+	excess := len(p.order) - MAX_PROCEDURES_HISTORY
+	if excess <= 0 {
+		return t
+	}
+	kept := p.order[:0]
+	for i, id := range p.order {
+		if excess == 0 {
+			kept = append(kept, p.order[i:]...)
+			break
+		}
+		if p.procedures[id].status.Status == ProcedurePending {
+			kept = append(kept, id)
+			continue
+		}
+		delete(p.procedures, id)
+		excess--
+	}
+	p.order = kept
+	return t
+}
+
+func (p *Procedures) finish(t *trackedProcedure, err error) {
+	p.Lock()
+	defer p.Unlock()
+	t.status.FinishedAt = time.Now()
+	if err != nil {
+		t.status.Status = ProcedureFailed
+		t.status.Error = err.Error()
+	} else {
+		t.status.Status = ProcedureSucceeded
+	}
+	metrics.Procedure(t.status.Procedure, string(t.status.Status))
+	close(t.done)
+}
+
+func (p *Procedures) Status(id uint64) (ProcedureStatus, bool) {
+	p.Lock()
+	defer p.Unlock()
+	t, ok := p.procedures[id]
+	if !ok {
+		return ProcedureStatus{}, false
+	}
+	return t.status, true
+}
+
+// Runs fn in background, and answers the control API call:
+// 202 with the procedure ID, or with "?wait=true", 200 with the status of the procedure once finished.
+func (p *Procedures) Start(c *gin.Context, ue jsonapi.ControlURI, name string, fn func() error) {
+	t := p.add(ue, name)
+	id := t.status.Id
+	go func() {
+		p.finish(t, fn())
+	}()
+	if wait, _ := strconv.ParseBool(c.Query("wait")); !wait {
+		c.JSON(http.StatusAccepted, ProcedureAccepted{Message: "please refer to logs for more information", ProcedureId: id})
+		return
+	}
+	select {
+	case <-t.done:
+		status, _ := p.Status(id)
+		c.JSON(http.StatusOK, status)
+	case <-c.Request.Context().Done():
+	}
+}
+
+// get status of a procedure
+func (p *Procedures) Get(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		logrus.WithError(err).Error("could not parse procedure id")
+		c.JSON(http.StatusBadRequest, jsonapi.MessageWithError{Message: "could not parse procedure id", Error: err})
+		return
+	}
+	status, ok := p.Status(id)
+	if !ok {
+		c.JSON(http.StatusNotFound, jsonapi.Message{Message: "procedure not found"})
+		return
+	}
+	c.Header("Cache-Control", "no-cache")
+	c.JSON(http.StatusOK, status)
+}
+
+func (p *Procedures) Register(e *gin.Engine) {
+	e.GET("/procedures/:id", p.Get)
+}
@@ -0,0 +1,25 @@
+// Copyright Louis Royer and the NextMN contributors. All rights reserved.
+// Use of this source code is governed by a MIT-style license that can be
+// found in the LICENSE file.
+// SPDX-License-Identifier: MIT
+
+//go:build linux
+
+package common
+
+import (
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// Allows several sockets to be bound to the same address: the kernel load balances received packets per flow
+func reusePort(network string, address string, c syscall.RawConn) error {
+	var err error
+	if cErr := c.Control(func(fd uintptr) {
+		err = unix.SetsockoptInt(int(fd), unix.SOL_SOCKET, unix.SO_REUSEPORT, 1)
+	}); cErr != nil {
+		return cErr
+	}
+	return err
+}
@@ -0,0 +1,16 @@
+// Copyright Louis Royer and the NextMN contributors. All rights reserved.
+// Use of this source code is governed by a MIT-style license that can be
+// found in the LICENSE file.
+// SPDX-License-Identifier: MIT
+
+//go:build !linux
+
+package common
+
+import (
+	"syscall"
+)
+
+func reusePort(network string, address string, c syscall.RawConn) error {
+	return ErrReusePortUnsupported
+}
@@ -0,0 +1,83 @@
+// Copyright Louis Royer and the NextMN contributors. All rights reserved.
+// Use of this source code is governed by a MIT-style license that can be
+// found in the LICENSE file.
+// SPDX-License-Identifier: MIT
+
+package common
+
+import (
+	"context"
+	"runtime"
+	"sync"
+)
+
+const (
+	DEFAULT_QUEUE_SIZE = 1024 // per worker
+)
+
+// Workers processing items from bounded queues.
+// Items dispatched with the same key are processed by the same worker, in order (e.g. packets of a UE).
+type Workers[T any] struct {
+	queues []chan T
+	handle func(context.Context, T)
+}
+
+// Creates count workers (one per CPU by default), each with a queue of queueSize items
+func NewWorkers[T any](count int, queueSize int, handle func(context.Context, T)) *Workers[T] {
+	if count <= 0 {
+		count = runtime.NumCPU()
+	}
+	if queueSize <= 0 {
+		queueSize = DEFAULT_QUEUE_SIZE
+	}
+	queues := make([]chan T, count)
+	for i := range queues {
+		queues[i] = make(chan T, queueSize)
+	}
+	return &Workers[T]{
+		queues: queues,
+		handle: handle,
+	}
+}
+
+// Runs the workers until ctx is done; items remaining in queues are not processed
+func (w *Workers[T]) Run(ctx context.Context) {
+	var wg sync.WaitGroup
+	for _, queue := range w.queues {
+		wg.Go(func() {
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case item := <-queue:
+					w.handle(ctx, item)
+				}
+			}
+		})
+	}
+	wg.Wait()
+}
+
+// Queues the item for the worker in charge of the key, without blocking
+func (w *Workers[T]) Dispatch(key uint64, item T) error {
+	select {
+	case w.queues[key%uint64(len(w.queues))] <- item:
+		return nil
+	default:
+		return ErrQueueFull
+	}
+}
+
+// Number of workers
+func (w *Workers[T]) Count() int {
+	return len(w.queues)
+}
+
+// Number of items waiting in queues
+func (w *Workers[T]) Len() int {
+	n := 0
+	for _, queue := range w.queues {
+		n += len(queue)
+	}
+	return n
+}
@@ -9,6 +9,7 @@ import (
 	"net/netip"
 	"os"
 	"path/filepath"
+	"time"
 
 	"github.com/nextmn/json-api/jsonapi"
 
@@ -33,11 +34,18 @@ func ParseConf(file string) (*GNBConfig, error) {
 }
 
 type GNBConfig struct {
-	Control Control    `yaml:"control"`
-	Ran     Ran        `yaml:"ran"`
-	Cp      Cp         `yaml:"cp"`
-	Logger  *Logger    `yaml:"logger,omitempty"`
-	Gtp     netip.Addr `yaml:"gtp"`
+	Control  Control     `yaml:"control"`
+	Ran      Ran         `yaml:"ran"`
+	Cp       Cp          `yaml:"cp"`
+	Logger   *Logger     `yaml:"logger,omitempty"`
+	Gtp      netip.Addr  `yaml:"gtp"`          // N3 address (GTP-U), used by default when n3 is also set
+	N3       []N3Address `yaml:"n3,omitempty"` // additional N3 addresses
+	GtpPath  *GtpPath    `yaml:"gtp-path,omitempty"`
+	ErrorInd *ErrorInd   `yaml:"error-indication,omitempty"`
+	Handover *Handover   `yaml:"handover,omitempty"`
+	Qos      *Qos        `yaml:"qos,omitempty"`
+	Outbound *Outbound   `yaml:"outbound,omitempty"`
+	Pipeline *Pipeline   `yaml:"pipeline,omitempty"`
 }
 
 type Control struct {
@@ -47,8 +55,111 @@ type Control struct {
 
 type Ran struct {
 	BindAddr netip.AddrPort `yaml:"bind-addr"`
+	Channel  *Channel       `yaml:"channel,omitempty"`   // radio channel impairments (perfect channel by default)
+	DlBuffer *DlBuffer      `yaml:"dl-buffer,omitempty"` // DL packets of UEs not joined yet (handover)
+}
+
+type DlBuffer struct {
+	Size   int           `yaml:"size"`    // maximum number of packets per UE
+	MaxAge time.Duration `yaml:"max-age"` // packets buffered for longer are dropped, e.g. "2s"
+}
+
+// Default radio channel parameters of UEs, per direction (they can be changed at runtime using the control API)
+type Channel struct {
+	Uplink   *ChannelParams `yaml:"uplink,omitempty"`
+	Downlink *ChannelParams `yaml:"downlink,omitempty"`
+}
+
+type ChannelParams struct {
+	Loss           float64         `yaml:"loss"` // Bernoulli loss probability
+	GilbertElliott *GilbertElliott `yaml:"gilbert-elliott,omitempty"`
+	Delay          time.Duration   `yaml:"delay"`   // e.g. "10ms"
+	Jitter         time.Duration   `yaml:"jitter"`  // e.g. "2ms"
+	Reorder        float64         `yaml:"reorder"` // probability for a packet to be sent without delay
+	Rate           uint64          `yaml:"rate"`    // bandwidth cap, in bits per second
+}
+
+// Gilbert-Elliott loss model (replaces Bernoulli loss)
+type GilbertElliott struct {
+	P        float64 `yaml:"p"` // transition probability from good state to bad state
+	R        float64 `yaml:"r"` // transition probability from bad state to good state
+	LossGood float64 `yaml:"loss-good"`
+	LossBad  float64 `yaml:"loss-bad"`
+}
+
+// N3 address (IPv4 or IPv6) with optional selection rules:
+// when rules are set, the address is only used for PDU Sessions matching each of them
+// (PDU Sessions are rejected when no N3 address of the IP version of the UPF can be used)
+type N3Address struct {
+	Addr   netip.Addr     `yaml:"addr"`
+	Upfs   []netip.Prefix `yaml:"upfs,omitempty"` // prefixes containing the address of the UPF, e.g. "10.1.0.0/24"
+	Dnns   []string       `yaml:"dnns,omitempty"`
+	Slices []Snssai       `yaml:"slices,omitempty"`
+}
+
+type Snssai struct {
+	Sst uint8  `yaml:"sst"`
+	Sd  string `yaml:"sd,omitempty"` // any Slice Differentiator when empty
 }
 
 type Cp struct {
 	Uri jsonapi.ControlURI `yaml:"uri"` // uri of the control plane
 }
+
+// GTP-U path management (Echo Request/Response) towards UPFs
+type GtpPath struct {
+	EchoInterval time.Duration `yaml:"echo-interval"` // interval between two Echo Requests to the same peer, e.g. "60s"
+	T3Response   time.Duration `yaml:"t3-response"`   // time to wait for an Echo Response before retransmission, e.g. "2s"
+	N3Requests   int           `yaml:"n3-requests"`   // number of retransmissions before considering the path down
+}
+
+// GTP-U Error Indication (disabled by default)
+type ErrorInd struct {
+	Send   bool `yaml:"send"`   // send Error Indication when receiving a T-PDU with an unknown TEID (at most once per second per peer and TEID)
+	Handle bool `yaml:"handle"` // release PDU Sessions when receiving Error Indication, and notify the CP
+}
+
+type Handover struct {
+	// after a Handover Command, the source gNB forwards DL traffic to the target gNB
+	// until an End Marker is received or this timeout is reached, then the source PDU Session is removed
+	ForwardingTimeout time.Duration `yaml:"forwarding-timeout"` // e.g. "10s"
+}
+
+type Qos struct {
+	// send DL traffic received with a PDU Session Container to the UE in QoS radio frames,
+	// carrying its QFI and RQI (disabled by default)
+	RadioFrames bool `yaml:"radio-frames"`
+
+	// lifetime of UL QoS rules derived from DL traffic with RQI set (reflective QoS), e.g. "60s"
+	ReflectiveQosTimer time.Duration `yaml:"reflective-qos-timer"`
+
+	// AMBRs used when not provided in session setup messages (no policing by default)
+	UeAmbr      *BitRate `yaml:"ue-ambr,omitempty"`
+	SessionAmbr *BitRate `yaml:"session-ambr,omitempty"`
+}
+
+// Bit rate, in bits per second (0: no policing)
+type BitRate struct {
+	Uplink   uint64 `yaml:"uplink"`
+	Downlink uint64 `yaml:"downlink"`
+}
+
+// Messages sent to the control API of UEs, gNBs, and the CP.
+// Procedures of a UE are serialised: while a procedure is sending messages (with retries),
+// other procedures of the UE (including Handover Cancel and releases) wait, for up to procedure-timeout.
+type Outbound struct {
+	Timeout          time.Duration `yaml:"timeout"`           // per attempt, e.g. "5s"
+	Retries          *int          `yaml:"retries,omitempty"` // retransmissions when the peer could not be reached, or on 503 or 429 status code
+	Backoff          time.Duration `yaml:"backoff"`           // delay before the first retransmission, doubled each time, e.g. "100ms"
+	MaxBackoff       time.Duration `yaml:"max-backoff"`       // e.g. "2s"
+	ProcedureTimeout time.Duration `yaml:"procedure-timeout"` // for all messages sent by a procedure, retries included, e.g. "30s"
+}
+
+// User plane packet processing: packets of a UE (uplink) or of a tunnel (downlink) are always handled by the same worker
+type Pipeline struct {
+	UplinkWorkers   int `yaml:"uplink-workers"`   // default: number of CPUs
+	DownlinkWorkers int `yaml:"downlink-workers"` // default: number of CPUs
+	QueueSize       int `yaml:"queue-size"`       // per worker, packets are dropped when the queue is full (default: 1024)
+	BatchSize       int `yaml:"batch-size"`       // packets read or written per syscall (recvmmsg/sendmmsg), disabled when lower than 2
+	N3Sockets       int `yaml:"n3-sockets"`       // sockets bound to gtp:2152 (SO_REUSEPORT), used for both sending and receiving (default: 1)
+}
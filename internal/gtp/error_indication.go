@@ -0,0 +1,59 @@
+// Copyright Louis Royer and the NextMN contributors. All rights reserved.
+// Use of this source code is governed by a MIT-style license that can be
+// found in the LICENSE file.
+// SPDX-License-Identifier: MIT
+
+package gtp
+
+import (
+	"net/netip"
+	"sync"
+	"time"
+)
+
+// At most one Error Indication is sent per peer and TEID every ERROR_INDICATION_INTERVAL,
+// and at most MAX_ERROR_INDICATION_ENTRIES per interval over all peers and TEIDs,
+// so a peer sending T-PDUs on an unknown TEID does not get one Error Indication per T-PDU.
+const (
+	ERROR_INDICATION_INTERVAL    = time.Second
+	MAX_ERROR_INDICATION_ENTRIES = 4096
+)
+
+type errIndKey struct {
+	peer netip.Addr
+	teid uint32
+}
+
+type errIndLimiter struct {
+	sync.Mutex
+	sent map[errIndKey]time.Time // last Error Indication sent
+}
+
+func newErrIndLimiter() *errIndLimiter {
+	return &errIndLimiter{
+		sent: make(map[errIndKey]time.Time),
+	}
+}
+
+// Returns true if an Error Indication can be sent to this peer for this TEID
+func (l *errIndLimiter) allow(peer netip.Addr, teid uint32) bool {
+	key := errIndKey{peer: peer.Unmap(), teid: teid}
+	now := time.Now()
+	l.Lock()
+	defer l.Unlock()
+	if last, ok := l.sent[key]; ok && now.Sub(last) < ERROR_INDICATION_INTERVAL {
+		return false
+	}
+	if len(l.sent) >= MAX_ERROR_INDICATION_ENTRIES {
+		for k, last := range l.sent {
+			if now.Sub(last) >= ERROR_INDICATION_INTERVAL {
+				delete(l.sent, k)
+			}
+		}
+		if len(l.sent) >= MAX_ERROR_INDICATION_ENTRIES {
+			return false
+		}
+	}
+	l.sent[key] = now
+	return true
+}
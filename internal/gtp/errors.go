@@ -0,0 +1,15 @@
+// Copyright Louis Royer and the NextMN contributors. All rights reserved.
+// Use of this source code is governed by a MIT-style license that can be
+// found in the LICENSE file.
+// SPDX-License-Identifier: MIT
+
+package gtp
+
+import (
+	"errors"
+)
+
+var (
+	ErrMissingTeidDataI = errors.New("missing TEID Data I IE")
+	ErrNoN3Address      = errors.New("no N3 address of the IP version of the peer")
+)
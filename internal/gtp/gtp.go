@@ -7,75 +7,350 @@ package gtp
 
 import (
 	"context"
-	"net"
+	"encoding/binary"
 	"net/netip"
+	"sync"
 
+	"github.com/nextmn/gnb-lite/internal/common"
+	"github.com/nextmn/gnb-lite/internal/metrics"
 	"github.com/nextmn/gnb-lite/internal/radio"
 	"github.com/nextmn/gnb-lite/internal/session"
 
+	"github.com/nextmn/json-api/jsonapi"
+
+	"github.com/gin-gonic/gin"
 	"github.com/sirupsen/logrus"
 	"github.com/wmnsk/go-gtp/gtpv1"
+	"github.com/wmnsk/go-gtp/gtpv1/ie"
 	"github.com/wmnsk/go-gtp/gtpv1/message"
 )
 
 type Gtp struct {
-	ipAddr  netip.Addr
-	psMan   *session.PduSessionsManager
-	rDaemon *radio.RadioDaemon
-	closed  chan struct{}
+	addrs        []netip.Addr
+	psMan        *session.PduSessionsManager
+	ps           *session.PduSessions
+	rDaemon      *radio.RadioDaemon
+	paths        *PathManager
+	errIndSend   bool
+	errIndLimit  *errIndLimiter
+	errIndHandle bool
+	qosFrames    bool
+	n3           *n3Sockets
+	sockets      int
+	batchSize    int
+	buffers      *common.BufferPool
+	downlink     *common.Workers[downlinkPacket]
+	closed       chan struct{}
 }
 
-const GTPU_PORT = 2152
+const (
+	GTPU_PORT = 2152
+)
 
-func NewGtp(ipAddr netip.Addr, psMan *session.PduSessionsManager, rDaemon *radio.RadioDaemon) *Gtp {
-	return &Gtp{
-		ipAddr:  ipAddr,
-		psMan:   psMan,
-		rDaemon: rDaemon,
-		closed:  make(chan struct{}),
+// T-PDU or End Marker received on N3, waiting for a downlink worker
+type downlinkPacket struct {
+	buf    *[]byte
+	n      int
+	local  netip.Addr // N3 address the packet has been received on
+	sender netip.AddrPort
+}
+
+// DL packets are handled by workers (one per CPU when workers is 0): packets of a tunnel (TEID) are always handled by the same worker
+// N3 uses the given number of sockets (at least one) bound to each address (port 2152), for both sending and receiving;
+// batched I/O is used when batchSize is greater than 1
+func NewGtp(addrs []netip.Addr, psMan *session.PduSessionsManager, ps *session.PduSessions, rDaemon *radio.RadioDaemon, paths *PathManager, errIndSend bool, errIndHandle bool, qosFrames bool, workers int, queueSize int, sockets int, batchSize int) *Gtp {
+	gtp := &Gtp{
+		addrs:        addrs,
+		psMan:        psMan,
+		ps:           ps,
+		rDaemon:      rDaemon,
+		paths:        paths,
+		errIndSend:   errIndSend,
+		errIndLimit:  newErrIndLimiter(),
+		errIndHandle: errIndHandle,
+		qosFrames:    qosFrames,
+		buffers:      common.NewRxBufferPool(),
+		sockets:      sockets,
+		batchSize:    batchSize,
+		closed:       make(chan struct{}),
 	}
+	gtp.downlink = common.NewWorkers(workers, queueSize, gtp.handleDownlink)
+	return gtp
+}
+
+// Number of DL packets waiting for a worker
+func (gtp *Gtp) DownlinkQueueLen() int {
+	return gtp.downlink.Len()
 }
 
 func (gtp *Gtp) Start(ctx context.Context) error {
-	logrus.WithFields(logrus.Fields{"listen-addr": gtp.ipAddr}).Info("Creating new GTP-U Protocol Entity")
-	laddr := net.UDPAddrFromAddrPort(netip.AddrPortFrom(gtp.ipAddr, GTPU_PORT))
-	uConn := gtpv1.NewUPlaneConn(laddr)
-	uConn.DisableErrorIndication()
-	uConn.AddHandler(message.MsgTypeTPDU, func(c gtpv1.Conn, senderAddr net.Addr, msg message.Message) error {
-		return gtp.tpduHandler(ctx, c, senderAddr, msg)
+	logrus.WithFields(logrus.Fields{"listen-addr": gtp.addrs}).Info("Creating new GTP-U Protocol Entity")
+	n3, err := listenN3(ctx, gtp.addrs, gtp.sockets, gtp.batchSize)
+	if err != nil {
+		return err
+	}
+	gtp.n3 = n3
+	var wg sync.WaitGroup
+	wg.Go(func() {
+		gtp.downlink.Run(ctx)
 	})
-	go func(ctx context.Context) error {
-		defer close(gtp.closed)
-		defer uConn.Close()
-		if err := uConn.ListenAndServe(ctx); err != nil {
-			logrus.WithError(err).Trace("GTP uConn closed")
-			return err
+	for local, pool := range n3.pools {
+		// uplink traffic is sent from the same sockets
+		gtp.psMan.SetN3Writer(local, pool)
+		pool.Run(ctx)
+		for _, conn := range pool.Conns() {
+			wg.Go(func() {
+				if err := gtp.serve(ctx, local, conn); err != nil && ctx.Err() == nil {
+					logrus.WithError(err).Trace("GTP conn closed")
+					return
+				}
+				logrus.Trace("GTP conn closed")
+			})
 		}
-		logrus.Trace("GTP uConn closed")
-		return nil
+	}
+	go func(ctx context.Context) {
+		<-ctx.Done()
+		n3.Close()
 	}(ctx)
+	go func() {
+		defer close(gtp.closed)
+		wg.Wait()
+	}()
+	go gtp.paths.Run(ctx, n3)
 
 	return nil
 }
 
+// Reads GTP-U messages: T-PDUs and End Markers are dispatched to downlink workers, other messages are handled directly
+func (gtp *Gtp) serve(ctx context.Context, local netip.Addr, conn *common.PacketConn) error {
+	return conn.ReadPackets(gtp.buffers, func(buf *[]byte, n int, sender netip.AddrPort) {
+		if n < 8 {
+			gtp.buffers.Put(buf)
+			logrus.WithFields(logrus.Fields{
+				"peer": sender,
+			}).Trace("GTP-U message too short")
+			return
+		}
+		switch (*buf)[1] {
+		case message.MsgTypeTPDU, message.MsgTypeEndMarker:
+			teid := binary.BigEndian.Uint32((*buf)[4:8])
+			if err := gtp.downlink.Dispatch(uint64(teid), downlinkPacket{buf: buf, n: n, local: local, sender: sender}); err != nil {
+				gtp.buffers.Put(buf)
+				logrus.WithFields(logrus.Fields{
+					"teid": teid,
+				}).Trace("DL queue full: dropping packet")
+				metrics.Drop(err)
+			}
+		default:
+			gtp.handleMessage(ctx, local, (*buf)[:n], sender)
+			gtp.buffers.Put(buf)
+		}
+	})
+}
+
+// Handles a T-PDU or an End Marker (downlink worker)
+func (gtp *Gtp) handleDownlink(ctx context.Context, pkt downlinkPacket) {
+	defer gtp.buffers.Put(pkt.buf)
+	msg, err := message.Parse((*pkt.buf)[:pkt.n])
+	if err != nil {
+		logrus.WithError(err).WithFields(logrus.Fields{
+			"peer": pkt.sender,
+		}).Trace("Could not parse GTP-U message")
+		metrics.Drop(err)
+		return
+	}
+	switch msg.MessageType() {
+	case message.MsgTypeTPDU:
+		metrics.Drop(gtp.tpduHandler(ctx, pkt.local, pkt.sender, msg))
+	case message.MsgTypeEndMarker:
+		if err := gtp.endMarkerHandler(ctx, msg); err != nil {
+			logrus.WithError(err).Trace("Could not handle End Marker")
+		}
+	}
+}
+
+// Handles GTP-U messages other than T-PDUs and End Markers
+func (gtp *Gtp) handleMessage(ctx context.Context, local netip.Addr, b []byte, sender netip.AddrPort) {
+	msg, err := message.Parse(b)
+	if err != nil {
+		logrus.WithError(err).WithFields(logrus.Fields{
+			"peer": sender,
+		}).Trace("Could not parse GTP-U message")
+		return
+	}
+	switch msg.MessageType() {
+	case message.MsgTypeEchoRequest:
+		err = gtp.echoRequestHandler(ctx, local, sender, msg)
+	case message.MsgTypeEchoResponse:
+		err = gtp.echoResponseHandler(ctx, sender, msg)
+	case message.MsgTypeErrorIndication:
+		if !gtp.errIndHandle {
+			return
+		}
+		err = gtp.errorIndicationHandler(ctx, sender, msg)
+	default:
+		logrus.WithFields(logrus.Fields{
+			"peer":     sender,
+			"msg-type": msg.MessageTypeName(),
+		}).Trace("Unexpected GTP-U message")
+		return
+	}
+	if err != nil {
+		logrus.WithError(err).WithFields(logrus.Fields{
+			"peer":     sender,
+			"msg-type": msg.MessageTypeName(),
+		}).Trace("Could not handle GTP-U message")
+	}
+}
+
+// Sends an Error Indication in response to a message received on the N3 address local with an unknown TEID
+func (gtp *Gtp) sendErrorIndication(local netip.Addr, raddr netip.AddrPort, received message.Message) error {
+	b, err := message.NewErrorIndication(
+		0, received.Sequence(),
+		ie.NewTEIDDataI(received.TEID()),
+		ie.NewGSNAddress(local.String()),
+	).Marshal()
+	if err != nil {
+		return err
+	}
+	_, err = gtp.n3.WriteFrom(local, b, raddr)
+	return err
+}
+
 // handle GTP PDU (Downlink)
-func (gtp *Gtp) tpduHandler(ctx context.Context, c gtpv1.Conn, senderAddr net.Addr, msg message.Message) error {
+func (gtp *Gtp) tpduHandler(ctx context.Context, local netip.Addr, senderAddr netip.AddrPort, msg message.Message) error {
 	teid := msg.TEID()
+	tpdu, ok := msg.(*message.TPDU)
+	if !ok {
+		return gtpv1.ErrUnexpectedType
+	}
+	metrics.Packet(metrics.PathN3Downlink, len(tpdu.Payload))
+	container, err := session.ParsePduSessionContainer(tpdu.Header)
+	hasContainer := err == nil
+	if err != nil && err != session.ErrNoPduSessionContainer {
+		logrus.WithError(err).WithFields(logrus.Fields{
+			"teid": teid,
+		}).Debug("Could not parse PDU Session Container")
+	}
+
 	// Try forwarding downlink (handover)
 	if fd, err := gtp.psMan.GetForwarding(teid); err == nil {
-		packet := msg.(*message.TPDU).Decapsulate()
-		return gtp.psMan.ForwardUplink(ctx, packet, fd)
+		packet := tpdu.Decapsulate()
+		if hasContainer {
+			// QoS Flow is kept on the forwarding tunnel
+			err = gtp.psMan.ForwardUplink(ctx, local, packet, fd, container.ExtensionHeader())
+		} else {
+			err = gtp.psMan.ForwardUplink(ctx, local, packet, fd)
+		}
+		if err != nil {
+			return err
+		}
+		metrics.Packet(metrics.PathForwarded, len(packet))
+		return nil
 	}
 
 	// Try to forward to UE over radio
 	ue, err := gtp.psMan.GetUECtrl(teid)
 	if err != nil {
+		if gtp.errIndSend && gtp.errIndLimit.allow(senderAddr.Addr(), teid) {
+			logrus.WithFields(logrus.Fields{
+				"teid": teid,
+				"peer": senderAddr,
+			}).Debug("Sending Error Indication")
+			if err := gtp.sendErrorIndication(local, senderAddr, msg); err != nil {
+				logrus.WithError(err).Error("Could not send Error Indication")
+			}
+		}
 		return err
 	}
-	packet := msg.(*message.TPDU).Decapsulate()
+	packet := tpdu.Decapsulate()
+	var qfi uint8
+	if hasContainer {
+		gtp.psMan.HandleDownlinkContainer(teid, container, packet)
+		qfi = container.Qfi
+	}
+	if !gtp.psMan.PoliceDownlink(teid, qfi, len(packet)) {
+		return session.ErrBitRateExceeded
+	}
+	psi, framed := gtp.psMan.RadioFraming(teid)
+	if hasContainer && gtp.qosFrames {
+		packet = radio.QosFrame(psi, container.Qfi, container.Rqi, packet)
+	} else if framed {
+		packet = radio.Frame(psi, packet)
+	}
+	if gtp.psMan.HoldDownlink(teid, senderAddr.Addr(), packet) {
+		// handover in progress: forwarded DL traffic is not finished
+		return nil
+	}
 	return gtp.rDaemon.WriteDownlink(packet, ue)
 }
 
+// handle GTP End Marker (Downlink, end of handover)
+func (gtp *Gtp) endMarkerHandler(ctx context.Context, msg message.Message) error {
+	return gtp.psMan.HandleEndMarker(ctx, msg.TEID())
+}
+
+// handle GTP Error Indication (Uplink TEID unknown by the UPF)
+func (gtp *Gtp) errorIndicationHandler(ctx context.Context, senderAddr netip.AddrPort, msg message.Message) error {
+	ind, ok := msg.(*message.ErrorIndication)
+	if !ok {
+		return gtpv1.ErrUnexpectedType
+	}
+	if ind.TEIDDataI == nil {
+		return ErrMissingTeidDataI
+	}
+	teid, err := ind.TEIDDataI.TEID()
+	if err != nil {
+		return err
+	}
+	var peer netip.Addr
+	if ind.GTPUPeerAddress != nil {
+		ip, err := ind.GTPUPeerAddress.IPAddress()
+		if err != nil {
+			return err
+		}
+		peer, err = netip.ParseAddr(ip)
+		if err != nil {
+			return err
+		}
+	} else {
+		peer = senderAddr.Addr()
+	}
+	logrus.WithFields(logrus.Fields{
+		"teid": teid,
+		"peer": peer,
+	}).Info("Error Indication received")
+	go gtp.ps.HandleErrorIndication(jsonapi.Fteid{Addr: peer.Unmap(), Teid: teid})
+	return nil
+}
+
+// handle GTP Echo Request (path management from peer)
+func (gtp *Gtp) echoRequestHandler(ctx context.Context, local netip.Addr, senderAddr netip.AddrPort, msg message.Message) error {
+	logrus.WithFields(logrus.Fields{
+		"peer": senderAddr,
+	}).Trace("Echo Request received")
+	rsp := message.NewEchoResponse(msg.Sequence(), ie.NewRecovery(0))
+	b, err := rsp.Marshal()
+	if err != nil {
+		return err
+	}
+	_, err = gtp.n3.WriteFrom(local, b, senderAddr)
+	return err
+}
+
+// handle GTP Echo Response (path management towards peer)
+func (gtp *Gtp) echoResponseHandler(ctx context.Context, senderAddr netip.AddrPort, msg message.Message) error {
+	rsp, ok := msg.(*message.EchoResponse)
+	if !ok {
+		return gtpv1.ErrUnexpectedType
+	}
+	return gtp.paths.HandleEchoResponse(senderAddr, rsp)
+}
+
+func (gtp *Gtp) Register(e *gin.Engine) {
+	e.GET("/gtp/paths", gtp.Paths)
+}
+
 func (gtp *Gtp) WaitShutdown(ctx context.Context) error {
 	select {
 	case <-ctx.Done():
@@ -0,0 +1,65 @@
+// Copyright Louis Royer and the NextMN contributors. All rights reserved.
+// Use of this source code is governed by a MIT-style license that can be
+// found in the LICENSE file.
+// SPDX-License-Identifier: MIT
+
+package gtp
+
+import (
+	"context"
+	"net/netip"
+
+	"github.com/nextmn/gnb-lite/internal/common"
+)
+
+// Sockets bound to each N3 address of the gNB
+type n3Sockets struct {
+	addrs []netip.Addr
+	pools map[netip.Addr]*common.PacketConnPool
+}
+
+// Opens count sockets (at least one) bound to each address, on the GTP-U port
+func listenN3(ctx context.Context, addrs []netip.Addr, count int, batchSize int) (*n3Sockets, error) {
+	n3 := &n3Sockets{
+		addrs: addrs,
+		pools: make(map[netip.Addr]*common.PacketConnPool, len(addrs)),
+	}
+	for _, addr := range addrs {
+		pool, err := common.ListenPacketConnPool(ctx, netip.AddrPortFrom(addr, GTPU_PORT), count, batchSize)
+		if err != nil {
+			n3.Close()
+			return nil, err
+		}
+		n3.pools[addr] = pool
+	}
+	return n3, nil
+}
+
+// Sends from the first N3 address of the IP version of the peer
+func (n3 *n3Sockets) WriteToUDPAddrPort(b []byte, addr netip.AddrPort) (int, error) {
+	for _, local := range n3.addrs {
+		if local.Is4() == addr.Addr().Unmap().Is4() {
+			return n3.pools[local].WriteToUDPAddrPort(b, addr)
+		}
+	}
+	return 0, ErrNoN3Address
+}
+
+// Sends from the given N3 address
+func (n3 *n3Sockets) WriteFrom(local netip.Addr, b []byte, addr netip.AddrPort) (int, error) {
+	pool, ok := n3.pools[local]
+	if !ok {
+		return n3.WriteToUDPAddrPort(b, addr)
+	}
+	return pool.WriteToUDPAddrPort(b, addr)
+}
+
+func (n3 *n3Sockets) Close() error {
+	var err error
+	for _, pool := range n3.pools {
+		if e := pool.Close(); e != nil {
+			err = e
+		}
+	}
+	return err
+}
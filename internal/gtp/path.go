@@ -0,0 +1,278 @@
+// Copyright Louis Royer and the NextMN contributors. All rights reserved.
+// Use of this source code is governed by a MIT-style license that can be
+// found in the LICENSE file.
+// SPDX-License-Identifier: MIT
+
+package gtp
+
+import (
+	"context"
+	"net/http"
+	"net/netip"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/nextmn/gnb-lite/internal/session"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+	"github.com/wmnsk/go-gtp/gtpv1/message"
+)
+
+const (
+	DEFAULT_ECHO_INTERVAL   = 60 * time.Second
+	DEFAULT_T3_RESPONSE     = 2 * time.Second
+	DEFAULT_N3_REQUESTS     = 3
+	PATH_DISCOVERY_INTERVAL = 1 * time.Second
+)
+
+type PathState string
+
+const (
+	PathStateUnknown PathState = "unknown"
+	PathStateUp      PathState = "up"
+	PathStateDown    PathState = "down"
+)
+
+type PathStatus struct {
+	Peer             netip.Addr `json:"peer"`
+	State            PathState  `json:"state"`
+	RestartCounter   *uint8     `json:"restart-counter,omitempty"`
+	LastEchoResponse *time.Time `json:"last-echo-response,omitempty"`
+}
+
+type echoResponse struct {
+	seq      uint16
+	recovery *uint8
+}
+
+// GTP-U path towards a peer (UPF, or gNB when forwarding)
+type Path struct {
+	sync.Mutex
+
+	peer             netip.Addr
+	state            PathState
+	restartCounter   *uint8
+	lastEchoResponse *time.Time
+	responses        chan echoResponse
+	cancel           context.CancelFunc // stops path management
+}
+
+func newPath(peer netip.Addr) *Path {
+	return &Path{
+		peer:      peer,
+		state:     PathStateUnknown,
+		responses: make(chan echoResponse, 1),
+	}
+}
+
+func (path *Path) up(recovery *uint8) {
+	path.Lock()
+	defer path.Unlock()
+	now := time.Now()
+	path.lastEchoResponse = &now
+	if path.state != PathStateUp {
+		logrus.WithFields(logrus.Fields{
+			"peer": path.peer,
+		}).Info("GTP-U path is up")
+		path.state = PathStateUp
+	}
+	if recovery == nil {
+		return
+	}
+	if path.restartCounter != nil && *path.restartCounter != *recovery {
+		logrus.WithFields(logrus.Fields{
+			"peer":                path.peer,
+			"old-restart-counter": *path.restartCounter,
+			"new-restart-counter": *recovery,
+		}).Warn("GTP-U peer has restarted")
+	}
+	path.restartCounter = recovery
+}
+
+func (path *Path) down() {
+	path.Lock()
+	defer path.Unlock()
+	if path.state != PathStateDown {
+		logrus.WithFields(logrus.Fields{
+			"peer": path.peer,
+		}).Warn("GTP-U path is down")
+		path.state = PathStateDown
+	}
+}
+
+func (path *Path) Status() PathStatus {
+	path.Lock()
+	defer path.Unlock()
+	return PathStatus{
+		Peer:             path.peer,
+		State:            path.state,
+		RestartCounter:   path.restartCounter,
+		LastEchoResponse: path.lastEchoResponse,
+	}
+}
+
+// PathManager periodically sends Echo Requests to every known GTP-U peer
+type PathManager struct {
+	sync.Mutex
+
+	psMan        *session.PduSessionsManager
+	paths        map[netip.Addr]*Path
+	seq          uint16
+	echoInterval time.Duration
+	t3Response   time.Duration
+	n3Requests   int
+}
+
+func NewPathManager(psMan *session.PduSessionsManager, echoInterval time.Duration, t3Response time.Duration, n3Requests int) *PathManager {
+	if echoInterval <= 0 {
+		echoInterval = DEFAULT_ECHO_INTERVAL
+	}
+	if t3Response <= 0 {
+		t3Response = DEFAULT_T3_RESPONSE
+	}
+	if n3Requests <= 0 {
+		n3Requests = DEFAULT_N3_REQUESTS
+	}
+	return &PathManager{
+		psMan:        psMan,
+		paths:        make(map[netip.Addr]*Path),
+		echoInterval: echoInterval,
+		t3Response:   t3Response,
+		n3Requests:   n3Requests,
+	}
+}
+
+// Discovers new peers and starts path management for them;
+// paths of peers without PDU Session or forwarding are stopped and removed
+func (pm *PathManager) Run(ctx context.Context, conn session.N3Writer) {
+	ticker := time.NewTicker(PATH_DISCOVERY_INTERVAL)
+	defer ticker.Stop()
+	for {
+		pm.updatePaths(ctx, conn, pm.psMan.GtpPeers())
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (pm *PathManager) updatePaths(ctx context.Context, conn session.N3Writer, peers []netip.Addr) {
+	pm.Lock()
+	defer pm.Unlock()
+	for _, peer := range peers {
+		if _, ok := pm.paths[peer]; !ok {
+			path := newPath(peer)
+			pathCtx, cancel := context.WithCancel(ctx)
+			path.cancel = cancel
+			pm.paths[peer] = path
+			go pm.runPath(pathCtx, conn, path)
+		}
+	}
+	for peer, path := range pm.paths {
+		if !slices.Contains(peers, peer) {
+			path.cancel()
+			delete(pm.paths, peer)
+			logrus.WithFields(logrus.Fields{
+				"peer": peer,
+			}).Debug("GTP-U path removed")
+		}
+	}
+}
+
+func (pm *PathManager) runPath(ctx context.Context, conn session.N3Writer, path *Path) {
+	for {
+		pm.echo(ctx, conn, path)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(pm.echoInterval):
+		}
+	}
+}
+
+// Sends an Echo Request, and retransmits it up to N3 times until an Echo Response is received
+func (pm *PathManager) echo(ctx context.Context, conn session.N3Writer, path *Path) {
+	raddr := netip.AddrPortFrom(path.peer, GTPU_PORT)
+	for i := 0; i <= pm.n3Requests; i++ {
+		seq := pm.nextSeq()
+		b, err := message.NewEchoRequest(seq).Marshal()
+		if err != nil {
+			logrus.WithError(err).Error("Could not marshal Echo Request")
+			return
+		}
+		if _, err := conn.WriteToUDPAddrPort(b, raddr); err != nil {
+			logrus.WithError(err).WithFields(logrus.Fields{
+				"peer": path.peer,
+			}).Debug("Could not send Echo Request")
+		}
+		timer := time.NewTimer(pm.t3Response)
+	wait:
+		for {
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return
+			case rsp := <-path.responses:
+				if rsp.seq != seq {
+					continue // late response to a previous request
+				}
+				timer.Stop()
+				path.up(rsp.recovery)
+				return
+			case <-timer.C:
+				break wait
+			}
+		}
+	}
+	path.down()
+}
+
+func (pm *PathManager) nextSeq() uint16 {
+	pm.Lock()
+	defer pm.Unlock()
+	pm.seq++
+	return pm.seq
+}
+
+func (pm *PathManager) HandleEchoResponse(senderAddr netip.AddrPort, msg *message.EchoResponse) error {
+	pm.Lock()
+	path, ok := pm.paths[senderAddr.Addr().Unmap()]
+	pm.Unlock()
+	if !ok {
+		logrus.WithFields(logrus.Fields{
+			"peer": senderAddr,
+		}).Trace("Echo Response from unknown peer")
+		return nil
+	}
+	rsp := echoResponse{seq: msg.Sequence()}
+	if msg.Recovery != nil {
+		if recovery, err := msg.Recovery.Recovery(); err == nil {
+			rsp.recovery = &recovery
+		}
+	}
+	select {
+	case path.responses <- rsp:
+	default:
+		// nobody is waiting for this response
+	}
+	return nil
+}
+
+func (pm *PathManager) Status() []PathStatus {
+	pm.Lock()
+	defer pm.Unlock()
+	res := make([]PathStatus, 0, len(pm.paths))
+	for _, path := range pm.paths {
+		res = append(res, path.Status())
+	}
+	return res
+}
+
+// get status of GTP-U paths
+func (gtp *Gtp) Paths(c *gin.Context) {
+	c.Header("Cache-Control", "no-cache")
+	c.JSON(http.StatusOK, gtp.paths.Status())
+}
@@ -0,0 +1,174 @@
+// Copyright Louis Royer and the NextMN contributors. All rights reserved.
+// Use of this source code is governed by a MIT-style license that can be
+// found in the LICENSE file.
+// SPDX-License-Identifier: MIT
+
+package metrics
+
+import (
+	"errors"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const NAMESPACE = "gnb"
+
+// User plane path of a packet
+type Path int
+
+const (
+	PathRadioUplink   Path = iota // received from the UE
+	PathN3Uplink                  // sent to the UPF
+	PathN3Downlink                // received from the UPF (or from the source gNB)
+	PathRadioDownlink             // sent to the UE
+	PathForwarded                 // DL packets forwarded to the target gNB (handover)
+	pathCount
+)
+
+func (p Path) String() string {
+	switch p {
+	case PathRadioUplink:
+		return "radio-ul"
+	case PathN3Uplink:
+		return "n3-ul"
+	case PathN3Downlink:
+		return "n3-dl"
+	case PathRadioDownlink:
+		return "radio-dl"
+	case PathForwarded:
+		return "forwarded"
+	default:
+		return "unknown"
+	}
+}
+
+const (
+	DIRECTION_UPLINK   = "uplink"
+	DIRECTION_DOWNLINK = "downlink"
+)
+
+// Reason of dropped packets that are not registered using AddDropReason
+const DROP_REASON_OTHER = "other"
+
+var (
+	packets = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: NAMESPACE,
+		Name:      "packets_total",
+		Help:      "Number of user plane packets, per path.",
+	}, []string{"path"})
+	bytes = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: NAMESPACE,
+		Name:      "bytes_total",
+		Help:      "Number of bytes of user plane packets (without GTP-U header), per path.",
+	}, []string{"path"})
+	drops = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: NAMESPACE,
+		Name:      "dropped_packets_total",
+		Help:      "Number of user plane packets dropped, per reason.",
+	}, []string{"reason"})
+	activePduSessions = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: NAMESPACE,
+		Name:      "active_pdu_sessions",
+		Help:      "Number of PDU Sessions.",
+	})
+	procedures = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: NAMESPACE,
+		Name:      "procedures_total",
+		Help:      "Number of procedures started by the control API, per procedure and result.",
+	}, []string{"procedure", "result"})
+	handoverPreparation = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: NAMESPACE,
+		Name:      "handover_preparation_duration_seconds",
+		Help:      "Source gNB: duration between the start of the handover and the Handover Command (or Xn Handover Request Ack).",
+		Buckets:   prometheus.ExponentialBuckets(0.001, 2, 14), // 1ms to 8s
+	}, []string{"type"})
+	handoverExecution = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: NAMESPACE,
+		Name:      "handover_execution_duration_seconds",
+		Help:      "Target gNB: duration between the allocation of resources for the handover and the Handover Confirm of the UE.",
+		Buckets:   prometheus.ExponentialBuckets(0.001, 2, 14),
+	}, []string{"type"})
+)
+
+// counters are resolved once, since they are used for each packet
+var pathPackets, pathBytes [pathCount]prometheus.Counter
+
+func init() {
+	for p := range pathCount {
+		pathPackets[p] = packets.WithLabelValues(p.String())
+		pathBytes[p] = bytes.WithLabelValues(p.String())
+	}
+}
+
+type dropReason struct {
+	err     error
+	counter prometheus.Counter
+}
+
+// Warning: not thread safe, drop reasons must be added before packets are handled
+var dropReasons []dropReason
+
+// Packets dropped with err (or an error wrapping err) are counted with the given reason
+func AddDropReason(err error, reason string) {
+	dropReasons = append(dropReasons, dropReason{err: err, counter: drops.WithLabelValues(reason)})
+}
+
+func Packet(path Path, size int) {
+	pathPackets[path].Inc()
+	pathBytes[path].Add(float64(size))
+}
+
+// Counts a packet dropped because of err (nothing is counted when err is nil)
+func Drop(err error) {
+	DropN(err, 1)
+}
+
+// Counts n packets dropped because of err (nothing is counted when err is nil)
+func DropN(err error, n int) {
+	if err == nil || n <= 0 {
+		return
+	}
+	for _, r := range dropReasons {
+		if errors.Is(err, r.err) {
+			r.counter.Add(float64(n))
+			return
+		}
+	}
+	drops.WithLabelValues(DROP_REASON_OTHER).Add(float64(n))
+}
+
+// Exports the number of packets waiting for a worker, for the given direction
+func QueueLength(direction string, length func() int) {
+	promauto.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace:   NAMESPACE,
+		Name:        "queued_packets",
+		Help:        "Number of user plane packets waiting for a worker, per direction.",
+		ConstLabels: prometheus.Labels{"direction": direction},
+	}, func() float64 {
+		return float64(length())
+	})
+}
+
+func SetActivePduSessions(n int) {
+	activePduSessions.Set(float64(n))
+}
+
+func Procedure(name string, result string) {
+	procedures.WithLabelValues(name, result).Inc()
+}
+
+func HandoverPreparation(hoType string, d time.Duration) {
+	handoverPreparation.WithLabelValues(hoType).Observe(d.Seconds())
+}
+
+func HandoverExecution(hoType string, d time.Duration) {
+	handoverExecution.WithLabelValues(hoType).Observe(d.Seconds())
+}
+
+func Register(e *gin.Engine) {
+	e.GET("/metrics", gin.WrapH(promhttp.Handler()))
+}
@@ -0,0 +1,396 @@
+// Copyright Louis Royer and the NextMN contributors. All rights reserved.
+// Use of this source code is governed by a MIT-style license that can be
+// found in the LICENSE file.
+// SPDX-License-Identifier: MIT
+
+package radio
+
+import (
+	"bytes"
+	"container/heap"
+	"context"
+	"encoding/json"
+	"math/rand/v2"
+	"sync"
+	"time"
+)
+
+// Maximum number of packets waiting in a radio channel (as netem's default limit)
+const CHANNEL_QUEUE_LIMIT = 1000
+
+type Direction string
+
+const (
+	DirectionUplink   Direction = "uplink"
+	DirectionDownlink Direction = "downlink"
+)
+
+// Duration is marshaled to JSON as a string, e.g. "10ms"
+type Duration time.Duration
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return err
+	}
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(v)
+	return nil
+}
+
+// Gilbert-Elliott loss model: a two-state Markov chain, with a loss probability in each state
+type GilbertElliott struct {
+	P        float64 `json:"p"`         // transition probability from good state to bad state
+	R        float64 `json:"r"`         // transition probability from bad state to good state
+	LossGood float64 `json:"loss-good"` // loss probability in good state
+	LossBad  float64 `json:"loss-bad"`  // loss probability in bad state
+}
+
+type ChannelParams struct {
+	Loss           float64         `json:"loss,omitempty"`            // Bernoulli loss probability
+	GilbertElliott *GilbertElliott `json:"gilbert-elliott,omitempty"` // when set, replaces Bernoulli loss
+	Delay          Duration        `json:"delay,omitzero"`
+	Jitter         Duration        `json:"jitter,omitzero"`   // delay varies uniformly in [delay-jitter, delay+jitter]
+	Reorder        float64         `json:"reorder,omitempty"` // probability for a packet to be sent without delay, overtaking previous packets
+	Rate           uint64          `json:"rate,omitempty"`    // bandwidth cap, in bits per second
+}
+
+func (p *ChannelParams) validate() error {
+	probabilities := []float64{p.Loss, p.Reorder}
+	if p.GilbertElliott != nil {
+		probabilities = append(probabilities, p.GilbertElliott.P, p.GilbertElliott.R, p.GilbertElliott.LossGood, p.GilbertElliott.LossBad)
+	}
+	for _, prob := range probabilities {
+		if prob < 0 || prob > 1 {
+			return ErrInvalidChannelParams
+		}
+	}
+	if p.Delay < 0 || p.Jitter < 0 {
+		return ErrInvalidChannelParams
+	}
+	return nil
+}
+
+// Returns true if the channel is a perfect lossless pipe
+func (p *ChannelParams) isPerfect() bool {
+	return p.Loss == 0 && p.GilbertElliott == nil && p.Delay == 0 && p.Jitter == 0 && p.Rate == 0
+}
+
+type ChannelStats struct {
+	Packets   uint64 `json:"packets"`
+	Delivered uint64 `json:"delivered"`
+	Lost      uint64 `json:"lost"`      // lost because of the loss model
+	Overflow  uint64 `json:"overflow"`  // dropped because the channel queue is full
+	Reordered uint64 `json:"reordered"` // sent without delay
+}
+
+type channelItem struct {
+	at      time.Time
+	seq     uint64
+	pkt     []byte
+	deliver func([]byte)
+}
+
+// min-heap of packets, by delivery time
+type channelQueue []*channelItem
+
+func (q channelQueue) Len() int { return len(q) }
+func (q channelQueue) Less(i, j int) bool {
+	if q[i].at.Equal(q[j].at) {
+		return q[i].seq < q[j].seq
+	}
+	return q[i].at.Before(q[j].at)
+}
+func (q channelQueue) Swap(i, j int) { q[i], q[j] = q[j], q[i] }
+func (q *channelQueue) Push(x any)   { *q = append(*q, x.(*channelItem)) }
+func (q *channelQueue) Pop() any {
+	old := *q
+	item := old[len(old)-1]
+	old[len(old)-1] = nil
+	*q = old[:len(old)-1]
+	return item
+}
+
+// Radio channel of a UE, in one direction
+type Channel struct {
+	sync.Mutex
+	ctx      context.Context
+	params   ChannelParams
+	override bool // params are specific to this UE
+	stats    ChannelStats
+
+	bad      bool      // state of the Gilbert-Elliott model
+	nextFree time.Time // end of transmission of the last packet (bandwidth cap)
+	lastAt   time.Time // delivery time of the last delayed packet
+	seq      uint64
+	queue    channelQueue
+	running  bool // packets are being delivered by run
+	wake     chan struct{}
+}
+
+func newChannel(ctx context.Context, params ChannelParams) *Channel {
+	return &Channel{
+		ctx:    ctx,
+		params: params,
+		wake:   make(chan struct{}, 1),
+	}
+}
+
+// Warning: not thread safe
+func (c *Channel) lost() bool {
+	ge := c.params.GilbertElliott
+	if ge == nil {
+		return c.params.Loss > 0 && rand.Float64() < c.params.Loss
+	}
+	loss := ge.LossGood
+	if c.bad {
+		loss = ge.LossBad
+	}
+	lost := loss > 0 && rand.Float64() < loss
+	if c.bad && rand.Float64() < ge.R {
+		c.bad = false
+	} else if !c.bad && rand.Float64() < ge.P {
+		c.bad = true
+	}
+	return lost
+}
+
+// Sends the packet through the channel: deliver is called when (and if) the packet goes out of the channel
+// pkt may be reused by the caller once Send returns
+func (c *Channel) Send(pkt []byte, deliver func([]byte)) {
+	c.Lock()
+	c.stats.Packets++
+	if c.params.isPerfect() && !c.running {
+		c.stats.Delivered++
+		c.Unlock()
+		deliver(pkt)
+		return
+	}
+	defer c.Unlock()
+	if c.lost() {
+		c.stats.Lost++
+		return
+	}
+	if c.queue.Len() >= CHANNEL_QUEUE_LIMIT {
+		c.stats.Overflow++
+		return
+	}
+	now := time.Now()
+	at := now
+	if c.params.Rate > 0 {
+		if c.nextFree.After(now) {
+			at = c.nextFree
+		}
+		at = at.Add(time.Duration(float64(len(pkt)*8) / float64(c.params.Rate) * float64(time.Second)))
+		c.nextFree = at
+	}
+	if c.params.Reorder > 0 && rand.Float64() < c.params.Reorder {
+		c.stats.Reordered++
+	} else {
+		delay := time.Duration(c.params.Delay)
+		if c.params.Jitter > 0 {
+			delay += time.Duration(rand.Int64N(2*int64(c.params.Jitter)+1) - int64(c.params.Jitter))
+		}
+		at = at.Add(max(delay, 0))
+		// jitter alone does not reorder packets
+		if at.Before(c.lastAt) {
+			at = c.lastAt
+		}
+		c.lastAt = at
+	}
+	c.seq++
+	heap.Push(&c.queue, &channelItem{at: at, seq: c.seq, pkt: bytes.Clone(pkt), deliver: deliver})
+	if !c.running {
+		c.running = true
+		go c.run()
+		return
+	}
+	select {
+	case c.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Delivers packets of the queue when their delivery time is reached.
+// Stops once the queue is empty: channels without packets in flight have no goroutine.
+func (c *Channel) run() {
+	timer := time.NewTimer(time.Hour)
+	defer timer.Stop()
+	for {
+		c.Lock()
+		if c.queue.Len() == 0 {
+			c.running = false
+			c.Unlock()
+			return
+		}
+		now := time.Now()
+		due := make([]*channelItem, 0)
+		for c.queue.Len() > 0 && !c.queue[0].at.After(now) {
+			due = append(due, heap.Pop(&c.queue).(*channelItem))
+		}
+		c.stats.Delivered += uint64(len(due))
+		var wait time.Duration
+		if c.queue.Len() > 0 {
+			wait = c.queue[0].at.Sub(now)
+		}
+		c.Unlock()
+		if len(due) > 0 {
+			for _, item := range due {
+				item.deliver(item.pkt)
+			}
+			continue
+		}
+		timer.Reset(wait)
+		select {
+		case <-c.ctx.Done():
+			c.Lock()
+			c.running = false
+			c.Unlock()
+			return
+		case <-c.wake:
+		case <-timer.C:
+		}
+	}
+}
+
+type channelKey struct {
+	ue        string // UE Control URI (empty for unknown UEs)
+	direction Direction
+}
+
+// Radio channels of every UE. UEs without specific parameters use default parameters.
+type ChannelModel struct {
+	sync.Mutex // defaults, and creation of channels
+	defaults   map[Direction]ChannelParams
+	channels   sync.Map // key: channelKey, value: *Channel
+}
+
+func NewChannelModel() *ChannelModel {
+	return &ChannelModel{
+		defaults: make(map[Direction]ChannelParams),
+	}
+}
+
+// Returns the radio channel of the UE, in this direction
+func (m *ChannelModel) Channel(ctx context.Context, ue string, direction Direction) *Channel {
+	key := channelKey{ue: ue, direction: direction}
+	if c, ok := m.channels.Load(key); ok {
+		return c.(*Channel)
+	}
+	m.Lock()
+	defer m.Unlock()
+	return m.channel(ctx, key)
+}
+
+// Warning: not thread safe
+func (m *ChannelModel) channel(ctx context.Context, key channelKey) *Channel {
+	if c, ok := m.channels.Load(key); ok {
+		return c.(*Channel)
+	}
+	c := newChannel(ctx, m.defaults[key.direction])
+	m.channels.Store(key, c)
+	return c
+}
+
+// Removes radio channels of the UE, unless they have specific parameters.
+// Packets already in a removed channel are still delivered.
+func (m *ChannelModel) RemoveUe(ue string) {
+	m.Lock()
+	defer m.Unlock()
+	for _, direction := range []Direction{DirectionUplink, DirectionDownlink} {
+		key := channelKey{ue: ue, direction: direction}
+		v, ok := m.channels.Load(key)
+		if !ok {
+			continue
+		}
+		c := v.(*Channel)
+		c.Lock()
+		if !c.override {
+			m.channels.Delete(key)
+		}
+		c.Unlock()
+	}
+}
+
+// Sets default parameters, used by UEs without specific parameters
+func (m *ChannelModel) SetDefault(direction Direction, params ChannelParams) error {
+	if err := params.validate(); err != nil {
+		return err
+	}
+	m.Lock()
+	defer m.Unlock()
+	m.defaults[direction] = params
+	for k, v := range m.channels.Range {
+		if k.(channelKey).direction != direction {
+			continue
+		}
+		c := v.(*Channel)
+		c.Lock()
+		if !c.override {
+			c.params = params
+		}
+		c.Unlock()
+	}
+	return nil
+}
+
+// Sets parameters specific to the UE (or removes them when params is nil)
+func (m *ChannelModel) SetUe(ctx context.Context, ue string, direction Direction, params *ChannelParams) error {
+	if params != nil {
+		if err := params.validate(); err != nil {
+			return err
+		}
+	}
+	m.Lock()
+	defer m.Unlock()
+	c := m.channel(ctx, channelKey{ue: ue, direction: direction})
+	c.Lock()
+	defer c.Unlock()
+	if params == nil {
+		c.params = m.defaults[direction]
+		c.override = false
+		return nil
+	}
+	c.params = *params
+	c.override = true
+	return nil
+}
+
+type ChannelStatus struct {
+	Ue        string        `json:"ue,omitempty"` // omitted for default parameters
+	Direction Direction     `json:"direction"`
+	Params    ChannelParams `json:"params"`
+	Override  bool          `json:"override,omitempty"` // parameters are specific to the UE
+	Stats     *ChannelStats `json:"stats,omitempty"`
+}
+
+// Returns default parameters, and the status of every radio channel
+func (m *ChannelModel) Status() []ChannelStatus {
+	m.Lock()
+	defer m.Unlock()
+	res := make([]ChannelStatus, 0, 2)
+	for _, direction := range []Direction{DirectionUplink, DirectionDownlink} {
+		res = append(res, ChannelStatus{Direction: direction, Params: m.defaults[direction]})
+	}
+	for k, v := range m.channels.Range {
+		key, c := k.(channelKey), v.(*Channel)
+		c.Lock()
+		stats := c.stats
+		res = append(res, ChannelStatus{
+			Ue:        key.ue,
+			Direction: key.direction,
+			Params:    c.params,
+			Override:  c.override,
+			Stats:     &stats,
+		})
+		c.Unlock()
+	}
+	return res
+}
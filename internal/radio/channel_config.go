@@ -0,0 +1,69 @@
+// Copyright Louis Royer and the NextMN contributors. All rights reserved.
+// Use of this source code is governed by a MIT-style license that can be
+// found in the LICENSE file.
+// SPDX-License-Identifier: MIT
+
+package radio
+
+import (
+	"net/http"
+
+	"github.com/nextmn/json-api/jsonapi"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+type ChannelConfig struct {
+	Ue        *jsonapi.ControlURI `json:"ue,omitempty"`        // when omitted, default parameters are set
+	Direction Direction           `json:"direction,omitempty"` // when omitted, both directions are set
+	Params    *ChannelParams      `json:"params,omitempty"`    // when omitted, parameters specific to the UE are removed
+}
+
+// get status of radio channels
+func (r *Radio) ChannelStatus(c *gin.Context) {
+	c.Header("Cache-Control", "no-cache")
+	c.JSON(http.StatusOK, r.Channels.Status())
+}
+
+// configure radio channels
+func (r *Radio) ConfigureChannel(c *gin.Context) {
+	var conf ChannelConfig
+	if err := c.BindJSON(&conf); err != nil {
+		logrus.WithError(err).Error("could not deserialize")
+		c.JSON(http.StatusBadRequest, jsonapi.MessageWithError{Message: "could not deserialize", Error: err})
+		return
+	}
+	directions := []Direction{DirectionUplink, DirectionDownlink}
+	switch conf.Direction {
+	case "":
+	case DirectionUplink, DirectionDownlink:
+		directions = []Direction{conf.Direction}
+	default:
+		c.JSON(http.StatusBadRequest, jsonapi.MessageWithError{Message: "invalid direction", Error: ErrInvalidChannelParams})
+		return
+	}
+	for _, direction := range directions {
+		var err error
+		if conf.Ue != nil {
+			err = r.Channels.SetUe(r.Context(), conf.Ue.String(), direction, conf.Params)
+		} else if conf.Params != nil {
+			err = r.Channels.SetDefault(direction, *conf.Params)
+		} else {
+			err = ErrInvalidChannelParams
+		}
+		if err != nil {
+			c.JSON(http.StatusBadRequest, jsonapi.MessageWithError{Message: "could not configure radio channel", Error: err})
+			return
+		}
+	}
+	logger := logrus.WithFields(logrus.Fields{
+		"direction": conf.Direction,
+		"params":    conf.Params,
+	})
+	if conf.Ue != nil {
+		logger = logger.WithField("ue", conf.Ue.String())
+	}
+	logger.Info("Radio channel configured")
+	c.JSON(http.StatusOK, r.Channels.Status())
+}
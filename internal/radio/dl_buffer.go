@@ -0,0 +1,191 @@
+// Copyright Louis Royer and the NextMN contributors. All rights reserved.
+// Use of this source code is governed by a MIT-style license that can be
+// found in the LICENSE file.
+// SPDX-License-Identifier: MIT
+
+package radio
+
+import (
+	"bytes"
+	"sync"
+	"time"
+
+	"github.com/nextmn/gnb-lite/internal/metrics"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	DEFAULT_DL_BUFFER_SIZE    = 1024 // packets per UE
+	DEFAULT_DL_BUFFER_MAX_AGE = 2 * time.Second
+)
+
+type DownlinkBufferStats struct {
+	Buffered    uint64 `json:"buffered"`
+	Flushed     uint64 `json:"flushed"`
+	DroppedFull uint64 `json:"dropped-full"` // dropped because the buffer of the UE is full
+	DroppedAge  uint64 `json:"dropped-age"`  // dropped because they were buffered for too long
+	Discarded   uint64 `json:"discarded"`    // dropped because the handover has been cancelled
+}
+
+type bufferedPacket struct {
+	pkt []byte
+	at  time.Time
+}
+
+type ueDownlinkBuffer struct {
+	packets   []bufferedPacket
+	heldUntil time.Time   // buffering was requested until the UE joins (handover), even if the UE is a known peer
+	timer     *time.Timer // removes the buffer once every packet has expired
+}
+
+// DL packets of UEs held for a handover (e.g. forwarded DL packets, before the UE joins the gNB)
+// are buffered, and sent in order when the UE joins
+// (or ahead of the next DL packet, when the UE is a known peer once the hold expired).
+type DownlinkBuffers struct {
+	sync.Mutex
+	size    int
+	maxAge  time.Duration
+	buffers map[string]*ueDownlinkBuffer // key: UE Control URI
+	stats   DownlinkBufferStats
+}
+
+func NewDownlinkBuffers(size int, maxAge time.Duration) *DownlinkBuffers {
+	if size <= 0 {
+		size = DEFAULT_DL_BUFFER_SIZE
+	}
+	if maxAge <= 0 {
+		maxAge = DEFAULT_DL_BUFFER_MAX_AGE
+	}
+	return &DownlinkBuffers{
+		size:    size,
+		maxAge:  maxAge,
+		buffers: make(map[string]*ueDownlinkBuffer),
+	}
+}
+
+// Returns true if DL packets of the UE must be buffered, even if the UE is a known peer
+// Warning: not thread safe
+func (b *DownlinkBuffers) held(ue string) bool {
+	buf, ok := b.buffers[ue]
+	return ok && time.Now().Before(buf.heldUntil)
+}
+
+// Requests buffering of DL packets of the UE, until the UE joins the gNB (or the maximum age is reached)
+// Warning: not thread safe
+func (b *DownlinkBuffers) hold(ue string) {
+	buf, ok := b.buffers[ue]
+	if !ok {
+		buf = &ueDownlinkBuffer{}
+		b.buffers[ue] = buf
+	}
+	buf.heldUntil = time.Now().Add(b.maxAge)
+	// packets are only buffered while the UE is held: they have all expired maxAge later
+	if buf.timer != nil {
+		buf.timer.Stop()
+	}
+	buf.timer = time.AfterFunc(2*b.maxAge, func() {
+		b.Lock()
+		defer b.Unlock()
+		if b.buffers[ue] != buf || time.Now().Before(buf.heldUntil.Add(b.maxAge)) {
+			return // buffer removed, or held again
+		}
+		b.stats.DroppedAge += uint64(len(buf.packets))
+		metrics.DropN(ErrDownlinkBufferAge, len(buf.packets))
+		b.remove(ue)
+	})
+}
+
+// Stops buffering DL packets of the UE
+// Warning: not thread safe
+func (b *DownlinkBuffers) remove(ue string) {
+	if buf, ok := b.buffers[ue]; ok && buf.timer != nil {
+		buf.timer.Stop()
+	}
+	delete(b.buffers, ue)
+}
+
+// Removes packets buffered for too long
+// Warning: not thread safe
+func (b *DownlinkBuffers) expire(buf *ueDownlinkBuffer, now time.Time) {
+	i := 0
+	for i < len(buf.packets) && now.Sub(buf.packets[i].at) > b.maxAge {
+		i++
+	}
+	if i > 0 {
+		b.stats.DroppedAge += uint64(i)
+		metrics.DropN(ErrDownlinkBufferAge, i)
+		buf.packets = buf.packets[i:]
+	}
+}
+
+// Buffers a DL packet of a held UE
+// Warning: not thread safe
+func (b *DownlinkBuffers) push(ue string, pkt []byte) error {
+	now := time.Now()
+	buf, ok := b.buffers[ue]
+	if !ok {
+		return ErrUnknownUE
+	}
+	b.expire(buf, now)
+	if len(buf.packets) >= b.size {
+		b.stats.DroppedFull++
+		return ErrDownlinkBufferFull
+	}
+	// pkt may be reused by the caller
+	buf.packets = append(buf.packets, bufferedPacket{pkt: bytes.Clone(pkt), at: now})
+	b.stats.Buffered++
+	return nil
+}
+
+// Returns packets buffered for the UE, and stops buffering
+// Warning: not thread safe
+func (b *DownlinkBuffers) pop(ue string) [][]byte {
+	buf, ok := b.buffers[ue]
+	if !ok {
+		return nil
+	}
+	b.remove(ue)
+	b.expire(buf, time.Now())
+	res := make([][]byte, len(buf.packets))
+	for i, p := range buf.packets {
+		res[i] = p.pkt
+	}
+	b.stats.Flushed += uint64(len(res))
+	if len(res) > 0 {
+		logrus.WithFields(logrus.Fields{
+			"ue":      ue,
+			"packets": len(res),
+		}).Info("Flushing buffered DL packets")
+	}
+	return res
+}
+
+// Drops packets buffered for the UE, and stops buffering
+// Warning: not thread safe
+func (b *DownlinkBuffers) discard(ue string) {
+	buf, ok := b.buffers[ue]
+	if !ok {
+		return
+	}
+	b.remove(ue)
+	b.stats.Discarded += uint64(len(buf.packets))
+}
+
+type DownlinkBufferStatus struct {
+	DownlinkBufferStats
+	Ues map[string]int `json:"ues"` // UE Control URI: number of buffered packets
+}
+
+func (b *DownlinkBuffers) Status() DownlinkBufferStatus {
+	b.Lock()
+	defer b.Unlock()
+	status := DownlinkBufferStatus{
+		DownlinkBufferStats: b.stats,
+		Ues:                 make(map[string]int, len(b.buffers)),
+	}
+	for ue, buf := range b.buffers {
+		status.Ues[ue] = len(buf.packets)
+	}
+	return status
+}
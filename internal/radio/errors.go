@@ -12,4 +12,11 @@ import (
 var (
 	ErrNilUdpConn = errors.New("nil UDP Connection")
 	ErrUnknownUE  = errors.New("unknown UE")
+
+	ErrMalformedFrame   = errors.New("malformed radio frame")
+	ErrUnknownFrameType = errors.New("unknown radio frame type")
+
+	ErrInvalidChannelParams = errors.New("invalid radio channel parameters")
+	ErrDownlinkBufferFull   = errors.New("DL buffer full")
+	ErrDownlinkBufferAge    = errors.New("DL packet buffered for too long")
 )
@@ -0,0 +1,89 @@
+// Copyright Louis Royer and the NextMN contributors. All rights reserved.
+// Use of this source code is governed by a MIT-style license that can be
+// found in the LICENSE file.
+// SPDX-License-Identifier: MIT
+
+package radio
+
+// Radio frames allow to carry traffic of non-IP PDU Sessions (Ethernet, Unstructured) over the radio link.
+// IP packets can still be sent without radio frame: the first nibble of a radio frame (0)
+// can not be confused with the version of an IP packet (4 or 6).
+//
+//	 0                   1
+//	 0 1 2 3 4 5 6 7 8 9 0 1 2 3 4 5
+//	+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-
+//	|  Frame Type   | PDU Session ID|  Payload…
+//	+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-
+//
+// QoS radio frames also carry the QoS Flow Identifier, and the Reflective QoS Indicator (DL only).
+// A QFI of 0 in an UL QoS radio frame lets the gNB choose the QoS Flow.
+//
+//	 0                   1                   2
+//	 0 1 2 3 4 5 6 7 8 9 0 1 2 3 4 5 6 7 8 9 0 1 2 3
+//	+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-
+//	|  Frame Type   | PDU Session ID|R| |    QFI    |  Payload…
+//	+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-
+const (
+	RADIO_FRAME_TYPE_PDU        = 0x01
+	RADIO_FRAME_TYPE_QOS_PDU    = 0x02
+	RADIO_FRAME_HEADER_SIZE     = 2
+	RADIO_QOS_FRAME_HEADER_SIZE = 3
+)
+
+type FrameHeader struct {
+	Type         uint8
+	PduSessionId uint8
+	Qfi          uint8 // QoS radio frames only
+	Rqi          bool  // QoS radio frames only
+}
+
+// Returns true if the packet is a radio frame
+func IsFrame(pkt []byte) bool {
+	return len(pkt) > 0 && (pkt[0]>>4) == 0
+}
+
+// Encapsulates the payload in a radio frame
+func Frame(psi uint8, payload []byte) []byte {
+	frame := make([]byte, RADIO_FRAME_HEADER_SIZE+len(payload))
+	frame[0] = RADIO_FRAME_TYPE_PDU
+	frame[1] = psi
+	copy(frame[RADIO_FRAME_HEADER_SIZE:], payload)
+	return frame
+}
+
+// Encapsulates the payload in a QoS radio frame
+func QosFrame(psi uint8, qfi uint8, rqi bool, payload []byte) []byte {
+	frame := make([]byte, RADIO_QOS_FRAME_HEADER_SIZE+len(payload))
+	frame[0] = RADIO_FRAME_TYPE_QOS_PDU
+	frame[1] = psi
+	frame[2] = qfi & 0x3f
+	if rqi {
+		frame[2] |= 0x80
+	}
+	copy(frame[RADIO_QOS_FRAME_HEADER_SIZE:], payload)
+	return frame
+}
+
+// Returns the header and the payload of a radio frame
+func ParseFrame(frame []byte) (FrameHeader, []byte, error) {
+	if len(frame) < RADIO_FRAME_HEADER_SIZE {
+		return FrameHeader{}, nil, ErrMalformedFrame
+	}
+	hdr := FrameHeader{
+		Type:         frame[0],
+		PduSessionId: frame[1],
+	}
+	switch hdr.Type {
+	case RADIO_FRAME_TYPE_PDU:
+		return hdr, frame[RADIO_FRAME_HEADER_SIZE:], nil
+	case RADIO_FRAME_TYPE_QOS_PDU:
+		if len(frame) < RADIO_QOS_FRAME_HEADER_SIZE {
+			return FrameHeader{}, nil, ErrMalformedFrame
+		}
+		hdr.Qfi = frame[2] & 0x3f
+		hdr.Rqi = frame[2]&0x80 != 0
+		return hdr, frame[RADIO_QOS_FRAME_HEADER_SIZE:], nil
+	default:
+		return FrameHeader{}, nil, ErrUnknownFrameType
+	}
+}
@@ -6,8 +6,6 @@
 package radio
 
 import (
-	"bytes"
-	"encoding/json"
 	"net/http"
 
 	"github.com/nextmn/json-api/jsonapi"
@@ -25,13 +23,14 @@ func (r *Radio) Peer(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, jsonapi.MessageWithError{Message: "could not deserialize", Error: err})
 		return
 	}
-	go r.HandlePeer(peer)
-	c.JSON(http.StatusAccepted, jsonapi.Message{Message: "please refer to logs for more information"})
+	r.procedures.Start(c, peer.Control, "radio-peer", func() error {
+		return r.HandlePeer(peer)
+	})
 }
 
-func (r *Radio) HandlePeer(peer n1n2.RadioPeerMsg) {
+func (r *Radio) HandlePeer(peer n1n2.RadioPeerMsg) error {
 	ctx := r.Context()
-	r.peerMap.Store(peer.Control.String(), peer.Data)
+	r.join(peer.Control, peer.Data)
 	logrus.WithFields(logrus.Fields{
 		"peer-control": peer.Control.String(),
 		"peer-ran":     peer.Data,
@@ -41,21 +40,10 @@ func (r *Radio) HandlePeer(peer n1n2.RadioPeerMsg) {
 		Data:    r.Data,
 	}
 
-	reqBody, err := json.Marshal(msg)
-	if err != nil {
-		logrus.WithError(err).Error("Could not Marshal n1n2.RadioPeerMsg")
-		return
-	}
-	req, err := http.NewRequestWithContext(ctx, http.MethodPost, peer.Control.JoinPath("radio/peer").String(), bytes.NewBuffer(reqBody))
-	if err != nil {
-		logrus.WithError(err).Error("Could not create radio/peer request")
-		return
-	}
-	req.Header.Set("User-Agent", r.UserAgent)
-	req.Header.Set("Content-Type", "application/json; charset=UTF-8")
-	if _, err := r.Client.Do(req); err != nil {
+	if err := r.Client.Post(ctx, peer.Control, "radio/peer", msg); err != nil {
 		logrus.WithError(err).Error("Could not send radio/peer request")
-		return
+		return err
 	}
 	// TODO: handle ue failure
+	return nil
 }
@@ -6,12 +6,13 @@
 package radio
 
 import (
-	"net"
 	"net/http"
 	"net/netip"
 	"sync"
+	"time"
 
 	"github.com/nextmn/gnb-lite/internal/common"
+	"github.com/nextmn/gnb-lite/internal/metrics"
 
 	"github.com/nextmn/json-api/jsonapi"
 
@@ -23,34 +24,135 @@ type Radio struct {
 	common.WithContext
 
 	peerMap   sync.Map // key:  UE Control URI (string), value: UE ran ip address
-	Client    http.Client
+	ueMap     sync.Map // key:  UE ran ip address, value: UE Control URI
+	Client    *common.Client
 	Control   jsonapi.ControlURI
 	Data      netip.AddrPort
-	UserAgent string
+	Channels  *ChannelModel
+	dlBuffers *DownlinkBuffers
+	srv       *common.PacketConn
+
+	procedures *common.Procedures
 }
 
-func NewRadio(control jsonapi.ControlURI, data netip.AddrPort, userAgent string) *Radio {
+func NewRadio(control jsonapi.ControlURI, data netip.AddrPort, client *common.Client, dlBufferSize int, dlBufferMaxAge time.Duration, procedures *common.Procedures) *Radio {
 	return &Radio{
-		peerMap:   sync.Map{},
-		Client:    http.Client{},
-		Control:   control,
-		Data:      data,
-		UserAgent: userAgent,
+		peerMap:    sync.Map{},
+		ueMap:      sync.Map{},
+		Client:     client,
+		Control:    control,
+		Data:       data,
+		Channels:   NewChannelModel(),
+		dlBuffers:  NewDownlinkBuffers(dlBufferSize, dlBufferMaxAge),
+		procedures: procedures,
 	}
 }
 
-func (r *Radio) Write(pkt []byte, srv *net.UDPConn, ue jsonapi.ControlURI) error {
+func (r *Radio) Write(pkt []byte, srv *common.PacketConn, ue jsonapi.ControlURI) error {
+	r.dlBuffers.Lock()
+	if r.dlBuffers.held(ue.String()) {
+		// the UE has not joined the gNB yet (e.g. forwarded DL packets during handover)
+		err := r.dlBuffers.push(ue.String(), pkt)
+		r.dlBuffers.Unlock()
+		logrus.WithFields(logrus.Fields{
+			"ue": ue.String(),
+		}).Trace("Buffering DL packet")
+		return err
+	}
 	ueRan, ok := r.peerMap.Load(ue.String())
+	if ok {
+		// the hold expired before the UE joined: packets buffered earlier are sent ahead of this one
+		r.flush(ue, ueRan.(netip.AddrPort))
+	}
+	r.dlBuffers.Unlock()
 	if !ok {
-		logrus.Trace("Unknown UE")
 		return ErrUnknownUE
 	}
+	r.send(pkt, srv, ue, ueRan.(netip.AddrPort))
+	return nil
+}
+
+func (r *Radio) send(pkt []byte, srv *common.PacketConn, ue jsonapi.ControlURI, ueRan netip.AddrPort) {
+	r.Channels.Channel(r.Context(), ue.String(), DirectionDownlink).Send(pkt, func(pkt []byte) {
+		if _, err := srv.WriteToUDPAddrPort(pkt, ueRan); err != nil {
+			logrus.WithError(err).Trace("Could not write packet to UE")
+			metrics.Drop(err)
+			return
+		}
+		metrics.Packet(metrics.PathRadioDownlink, len(pkt))
+	})
+}
+
+// Adds the UE as peer, and sends DL packets buffered before the UE joined, ahead of new DL packets
+func (r *Radio) join(ue jsonapi.ControlURI, ueRan netip.AddrPort) {
+	r.dlBuffers.Lock()
+	defer r.dlBuffers.Unlock()
+	r.peerMap.Store(ue.String(), ueRan)
+	r.ueMap.Store(ueRan, ue)
+	r.flush(ue, ueRan)
+}
+
+// Warning: dlBuffers must be locked
+func (r *Radio) flush(ue jsonapi.ControlURI, ueRan netip.AddrPort) {
+	packets := r.dlBuffers.pop(ue.String())
+	if r.srv == nil {
+		return
+	}
+	for _, pkt := range packets {
+		r.send(pkt, r.srv, ue, ueRan)
+	}
+}
+
+// DL packets of the UE are buffered until the UE joins the gNB (handover),
+// even if the UE is already a known peer
+func (r *Radio) BufferDownlink(ue jsonapi.ControlURI) {
+	r.dlBuffers.Lock()
+	defer r.dlBuffers.Unlock()
+	r.dlBuffers.hold(ue.String())
+}
+
+// Sends DL packets buffered for the UE, and stops buffering
+func (r *Radio) FlushDownlink(ue jsonapi.ControlURI) {
+	r.dlBuffers.Lock()
+	defer r.dlBuffers.Unlock()
+	ueRan, ok := r.peerMap.Load(ue.String())
+	if !ok {
+		// packets stay buffered until the UE joins
+		return
+	}
+	r.flush(ue, ueRan.(netip.AddrPort))
+}
 
-	_, err := srv.WriteToUDPAddrPort(pkt, ueRan.(netip.AddrPort))
+// Drops DL packets buffered for the UE, and stops buffering (cancelled handover)
+func (r *Radio) DiscardDownlink(ue jsonapi.ControlURI) {
+	r.dlBuffers.Lock()
+	defer r.dlBuffers.Unlock()
+	r.dlBuffers.discard(ue.String())
+}
 
-	return err
+// Removes radio channels of the UE (every PDU Session of the UE has been removed)
+func (r *Radio) RemoveUe(ue jsonapi.ControlURI) {
+	r.Channels.RemoveUe(ue.String())
+}
+
+// get status of DL buffers
+func (r *Radio) DownlinkBufferStatus(c *gin.Context) {
+	c.Header("Cache-Control", "no-cache")
+	c.JSON(http.StatusOK, r.dlBuffers.Status())
+}
+
+// Returns the UE Control URI of the UE using this radio address
+func (r *Radio) UE(ueRan netip.AddrPort) (jsonapi.ControlURI, error) {
+	ue, ok := r.ueMap.Load(ueRan)
+	if !ok {
+		return jsonapi.ControlURI{}, ErrUnknownUE
+	}
+	return ue.(jsonapi.ControlURI), nil
 }
 
 func (r *Radio) Register(e *gin.Engine) {
 	e.POST("/radio/peer", r.Peer)
+	e.GET("/radio/channel", r.ChannelStatus)
+	e.POST("/radio/channel", r.ConfigureChannel)
+	e.GET("/radio/dl-buffer", r.DownlinkBufferStatus)
 }
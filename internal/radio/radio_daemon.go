@@ -7,9 +7,12 @@ package radio
 
 import (
 	"context"
+	"hash/maphash"
 	"net"
 	"net/netip"
 
+	"github.com/nextmn/gnb-lite/internal/common"
+	"github.com/nextmn/gnb-lite/internal/metrics"
 	"github.com/nextmn/gnb-lite/internal/session"
 
 	"github.com/nextmn/json-api/jsonapi"
@@ -17,54 +20,104 @@ import (
 	"github.com/sirupsen/logrus"
 )
 
-const (
-	TUN_MTU = 1400
-)
+// Packet received from a UE, waiting for an uplink worker
+type uplinkPacket struct {
+	buf   *[]byte
+	n     int
+	ueRan netip.AddrPort
+}
 
 type RadioDaemon struct {
-	DlQueue            chan DLPkt
 	radio              *Radio
 	gnbRanAddr         netip.AddrPort
 	PduSessionsManager *session.PduSessionsManager
-	srv                *net.UDPConn
+	srv                *common.PacketConn
+	batchSize          int
+	buffers            *common.BufferPool
+	uplink             *common.Workers[uplinkPacket]
+	seed               maphash.Seed
 	closed             chan struct{}
 }
 
-func NewRadioDaemon(radio *Radio, psMan *session.PduSessionsManager, gnbRanAddr netip.AddrPort) *RadioDaemon {
-	return &RadioDaemon{
-		DlQueue:            make(chan DLPkt),
+// Uplink packets are handled by workers (one per CPU when workers is 0): packets of a UE are always handled by the same worker
+// Batched I/O is used when batchSize is greater than 1
+func NewRadioDaemon(radio *Radio, psMan *session.PduSessionsManager, gnbRanAddr netip.AddrPort, workers int, queueSize int, batchSize int) *RadioDaemon {
+	r := &RadioDaemon{
 		radio:              radio,
 		PduSessionsManager: psMan,
 		gnbRanAddr:         gnbRanAddr,
+		buffers:            common.NewRxBufferPool(),
+		batchSize:          batchSize,
+		seed:               maphash.MakeSeed(),
 		closed:             make(chan struct{}),
 	}
+	r.uplink = common.NewWorkers(workers, queueSize, r.handleUplink)
+	return r
+}
+
+// Number of UL packets waiting for a worker
+func (r *RadioDaemon) UplinkQueueLen() int {
+	return r.uplink.Len()
 }
 
-func (r *RadioDaemon) runUplinkDaemon(ctx context.Context, srv *net.UDPConn) error {
+func (r *RadioDaemon) runUplinkDaemon(ctx context.Context, srv *common.PacketConn) error {
 	if srv == nil {
 		logrus.Error("nil server")
 		return ErrNilUdpConn
 	}
-	for {
-		select {
-		case <-ctx.Done():
-			return ctx.Err()
-		default:
-			buf := make([]byte, TUN_MTU)
-			n, err := srv.Read(buf)
-			if err != nil {
-				logrus.WithError(err).Trace("error reading udp packet")
-				return err
-			}
-			logrus.Trace("received new packet from ue")
-			r.PduSessionsManager.WriteUplink(ctx, buf[:n])
+	err := srv.ReadPackets(r.buffers, func(buf *[]byte, n int, ueRan netip.AddrPort) {
+		logrus.Trace("received new packet from ue")
+		metrics.Packet(metrics.PathRadioUplink, n)
+		if err := r.uplink.Dispatch(maphash.Comparable(r.seed, ueRan), uplinkPacket{buf: buf, n: n, ueRan: ueRan}); err != nil {
+			r.buffers.Put(buf)
+			logrus.WithFields(logrus.Fields{
+				"ue-ran": ueRan,
+			}).Trace("UL queue full: dropping packet")
+			metrics.Drop(err)
 		}
+	})
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	logrus.WithError(err).Trace("error reading udp packet")
+	return err
+}
+
+// Sends the packet through the radio channel of the UE (uplink worker)
+func (r *RadioDaemon) handleUplink(ctx context.Context, pkt uplinkPacket) {
+	defer r.buffers.Put(pkt.buf)
+	var ueKey string
+	if ue, err := r.radio.UE(pkt.ueRan); err == nil {
+		ueKey = ue.String()
 	}
+	r.radio.Channels.Channel(ctx, ueKey, DirectionUplink).Send((*pkt.buf)[:pkt.n], func(b []byte) {
+		metrics.Drop(r.writeUplink(ctx, b, pkt.ueRan))
+	})
 }
 
-type DLPkt struct {
-	Ue      jsonapi.ControlURI
-	Payload []byte
+// Packet received from the UE, after going through the radio channel
+func (r *RadioDaemon) writeUplink(ctx context.Context, pkt []byte, ueRan netip.AddrPort) error {
+	if !IsFrame(pkt) {
+		return r.PduSessionsManager.WriteUplink(ctx, pkt)
+	}
+	return r.writeUplinkFrame(ctx, pkt, ueRan)
+}
+
+// Radio frame received from the UE: PDU Session is identified by its ID (and QoS Flow by its QFI)
+func (r *RadioDaemon) writeUplinkFrame(ctx context.Context, frame []byte, ueRan netip.AddrPort) error {
+	hdr, payload, err := ParseFrame(frame)
+	if err != nil {
+		logrus.WithError(err).Trace("could not parse radio frame")
+		return err
+	}
+	ue, err := r.radio.UE(ueRan)
+	if err != nil {
+		logrus.WithFields(logrus.Fields{
+			"ue-ran": ueRan,
+		}).Trace("radio frame from unknown UE")
+		return err
+	}
+	return r.PduSessionsManager.WriteUplinkFramed(ctx, ue, hdr.PduSessionId, hdr.Qfi, payload)
 }
 
 func (r *RadioDaemon) WriteDownlink(payload []byte, ue jsonapi.ControlURI) error {
@@ -74,19 +127,37 @@ func (r *RadioDaemon) WriteDownlink(payload []byte, ue jsonapi.ControlURI) error
 	return r.radio.Write(payload, r.srv, ue)
 }
 
+// DL packets of the UE are buffered until the UE joins the gNB
+func (r *RadioDaemon) BufferDownlink(ue jsonapi.ControlURI) {
+	r.radio.BufferDownlink(ue)
+}
+
+// Sends DL packets buffered for the UE
+func (r *RadioDaemon) FlushDownlink(ue jsonapi.ControlURI) {
+	r.radio.FlushDownlink(ue)
+}
+
+// Drops DL packets buffered for the UE
+func (r *RadioDaemon) DiscardDownlink(ue jsonapi.ControlURI) {
+	r.radio.DiscardDownlink(ue)
+}
+
 func (r *RadioDaemon) Start(ctx context.Context) error {
 	if err := r.radio.InitContext(ctx); err != nil {
 		return err
 	}
-	srv, err := net.ListenUDP("udp", net.UDPAddrFromAddrPort(r.gnbRanAddr))
+	conn, err := net.ListenUDP("udp", net.UDPAddrFromAddrPort(r.gnbRanAddr))
 	if err != nil {
 		return err
 	}
+	srv := common.NewPacketConn(conn, r.batchSize)
 	r.srv = srv
+	r.radio.srv = srv
 	logrus.WithFields(logrus.Fields{
 		"bind-addr": r.gnbRanAddr,
 	}).Info("Starting Radio Simulatior")
-	go func(ctx context.Context, srv *net.UDPConn) error {
+	go srv.Run(ctx)
+	go func(ctx context.Context, srv *common.PacketConn) error {
 		if srv == nil {
 			return ErrNilUdpConn
 		}
@@ -94,8 +165,14 @@ func (r *RadioDaemon) Start(ctx context.Context) error {
 		srv.Close()
 		return ctx.Err()
 	}(ctx, srv)
-	go func(ctx context.Context, srv *net.UDPConn) {
+	uplinkDone := make(chan struct{})
+	go func(ctx context.Context) {
+		defer close(uplinkDone)
+		r.uplink.Run(ctx)
+	}(ctx)
+	go func(ctx context.Context, srv *common.PacketConn) {
 		defer close(r.closed)
+		defer func() { <-uplinkDone }()
 		defer srv.Close()
 		r.runUplinkDaemon(ctx, srv)
 	}(ctx, srv)
@@ -0,0 +1,189 @@
+// Copyright Louis Royer and the NextMN contributors. All rights reserved.
+// Use of this source code is governed by a MIT-style license that can be
+// found in the LICENSE file.
+// SPDX-License-Identifier: MIT
+
+package session
+
+import (
+	"bytes"
+	"context"
+	"net/netip"
+
+	"github.com/nextmn/gnb-lite/internal/metrics"
+
+	"github.com/nextmn/json-api/jsonapi"
+
+	"github.com/sirupsen/logrus"
+	"github.com/wmnsk/go-gtp/gtpv1/message"
+)
+
+// maximum number of DL packets from the direct path held while waiting for an End Marker
+const MAX_HELD_DOWNLINK = 1024
+
+type DownlinkWriter interface {
+	WriteDownlink(payload []byte, ue jsonapi.ControlURI) error
+}
+
+// Implemented by DownlinkWriters able to buffer DL packets until the UE joins the gNB
+type DownlinkBuffer interface {
+	BufferDownlink(ue jsonapi.ControlURI)
+	FlushDownlink(ue jsonapi.ControlURI)
+	DiscardDownlink(ue jsonapi.ControlURI)
+}
+
+// DL packets of the UE are buffered until the UE joins the gNB (target gNB during handover)
+func (p *PduSessionsManager) BufferDownlink(ue jsonapi.ControlURI) {
+	p.Lock()
+	w := p.downlinkWriter
+	p.Unlock()
+	if b, ok := w.(DownlinkBuffer); ok {
+		b.BufferDownlink(ue)
+	}
+}
+
+// Sends DL packets buffered for the UE
+func (p *PduSessionsManager) FlushDownlink(ue jsonapi.ControlURI) {
+	p.Lock()
+	w := p.downlinkWriter
+	p.Unlock()
+	if b, ok := w.(DownlinkBuffer); ok {
+		b.FlushDownlink(ue)
+	}
+}
+
+// Drops DL packets buffered for the UE (cancelled handover)
+func (p *PduSessionsManager) DiscardDownlink(ue jsonapi.ControlURI) {
+	p.Lock()
+	w := p.downlinkWriter
+	p.Unlock()
+	if b, ok := w.(DownlinkBuffer); ok {
+		b.DiscardDownlink(ue)
+	}
+}
+
+// End Marker received on dlTeid.
+// On the source gNB, the End Marker is relayed on the forwarding tunnel and the source PDU Session is removed.
+// On the target gNB, forwarded DL traffic is finished: held DL packets from the direct path are sent to the UE.
+func (p *PduSessionsManager) HandleEndMarker(ctx context.Context, dlTeid uint32) error {
+	if p.forwardingTimers.Stop(dlTeid) {
+		logrus.WithFields(logrus.Fields{
+			"dl-teid": dlTeid,
+		}).Info("End Marker received: removing source PDU Session")
+		err := p.relayEndMarker(ctx, dlTeid)
+		p.removeSourcePduSession(dlTeid)
+		return err
+	}
+	if p.endMarkerTimers.Stop(dlTeid) {
+		logrus.WithFields(logrus.Fields{
+			"dl-teid": dlTeid,
+		}).Info("End Marker received: switching to direct DL path")
+		return p.switchToDirectPath(dlTeid)
+	}
+	return ErrPduSessionNotFound
+}
+
+// Sends an End Marker on the forwarding tunnel, after the last forwarded packet
+func (p *PduSessionsManager) relayEndMarker(ctx context.Context, dlTeid uint32) error {
+	p.Lock()
+	defer p.Unlock()
+	fteid, ok := p.forwardDownlink[dlTeid]
+	if !ok {
+		return ErrForwardDownlinkNotFound
+	}
+	em := message.NewEndMarker()
+	em.SetTEID(fteid.Teid)
+	logrus.WithFields(logrus.Fields{
+		"fteid": fteid,
+	}).Debug("Relaying End Marker")
+	var src netip.Addr
+	if session, ok := p.downlink[dlTeid]; ok {
+		src = session.DownlinkFteid.Addr
+	}
+	return p.writeN3(src, fteid, em)
+}
+
+// Target gNB: DL packets received on dlTeid from the direct path will be held
+// until an End Marker is received on the forwarding path, or until the timer expires.
+func (p *PduSessionsManager) AwaitEndMarker(dlTeid uint32) error {
+	p.Lock()
+	defer p.Unlock()
+	session, ok := p.downlink[dlTeid]
+	if !ok {
+		return ErrPduSessionNotFound
+	}
+	session.lock.Lock()
+	session.AwaitingEndMarker = true
+	session.lock.Unlock()
+	p.endMarkerTimers.Start(dlTeid, p.forwardingTimeout, func() {
+		logrus.WithFields(logrus.Fields{
+			"dl-teid": dlTeid,
+		}).Info("No End Marker received before timer expiration: switching to direct DL path")
+		if err := p.switchToDirectPath(dlTeid); err != nil {
+			logrus.WithError(err).Error("Could not switch to direct DL path")
+		}
+	})
+	return nil
+}
+
+// Returns true when the packet has been held (or dropped) because it was received on the direct path
+// while forwarded DL traffic is not finished.
+// DL packets from the direct path are held only once forwarded DL traffic has been seen.
+func (p *PduSessionsManager) HoldDownlink(dlTeid uint32, sender netip.Addr, pkt []byte) bool {
+	session, ok := p.tables.downlink.Load(dlTeid)
+	if !ok {
+		return false
+	}
+	session.lock.Lock()
+	defer session.lock.Unlock()
+	if !session.AwaitingEndMarker {
+		return false
+	}
+	if session.UplinkFteid == nil || session.UplinkFteid.Addr != sender.Unmap() {
+		// forwarded DL traffic
+		session.forwardingSeen = true
+		return false
+	}
+	if !session.forwardingSeen {
+		// no DL forwarding for this handover: the End Marker will not be relayed by the source gNB
+		return false
+	}
+	if len(session.heldDownlink) >= MAX_HELD_DOWNLINK {
+		logrus.WithFields(logrus.Fields{
+			"dl-teid": dlTeid,
+		}).Trace("Too many held DL packets: dropping packet")
+		metrics.Drop(ErrHeldDownlinkFull)
+		return true
+	}
+	// pkt may be reused by the caller
+	session.heldDownlink = append(session.heldDownlink, bytes.Clone(pkt))
+	return true
+}
+
+func (p *PduSessionsManager) switchToDirectPath(dlTeid uint32) error {
+	p.Lock()
+	session, ok := p.downlink[dlTeid]
+	if !ok {
+		p.Unlock()
+		return ErrPduSessionNotFound
+	}
+	session.lock.Lock()
+	session.AwaitingEndMarker = false
+	held := session.heldDownlink
+	session.heldDownlink = nil
+	session.lock.Unlock()
+	ue := session.UeCtrl
+	w := p.downlinkWriter
+	p.Unlock()
+
+	if w == nil {
+		return nil
+	}
+	for _, pkt := range held {
+		if err := w.WriteDownlink(pkt, ue); err != nil {
+			logrus.WithError(err).Trace("Could not send held DL packet")
+			metrics.Drop(err)
+		}
+	}
+	return nil
+}
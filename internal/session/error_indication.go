@@ -0,0 +1,66 @@
+// Copyright Louis Royer and the NextMN contributors. All rights reserved.
+// Use of this source code is governed by a MIT-style license that can be
+// found in the LICENSE file.
+// SPDX-License-Identifier: MIT
+
+package session
+
+import (
+	"github.com/nextmn/json-api/jsonapi"
+
+	"github.com/sirupsen/logrus"
+)
+
+type ErrorIndication struct {
+	// Header
+	Gnb    jsonapi.ControlURI `json:"gnb"`
+	Cp     jsonapi.ControlURI `json:"cp"`
+	UeCtrl jsonapi.ControlURI `json:"ue-ctrl"`
+
+	// Error Indication
+	Sessions []Session `json:"sessions"` // PDU Sessions released by the gNB
+}
+
+// Error Indication is send by an UPF to the gNB when receiving a T-PDU with an unknown TEID.
+// Upon receiving an Error Indication, the gNB removes the PDU Sessions using this uplink FTEID
+// and notify the Control Plane.
+func (p *PduSessions) HandleErrorIndication(uplinkFteid jsonapi.Fteid) {
+	ctx := p.Context()
+	released, err := p.manager.ReleaseUplinkFteid(uplinkFteid)
+	if err != nil {
+		logrus.WithError(err).WithFields(logrus.Fields{
+			"uplink-fteid": uplinkFteid,
+		}).Debug("Error Indication for unknown PDU Session")
+		return
+	}
+
+	// one notification per UE
+	perUe := make(map[string]*ErrorIndication)
+	for _, session := range released {
+		logrus.WithFields(logrus.Fields{
+			"ue":           session.UeCtrl.String(),
+			"ue-addr":      session.UeAddr,
+			"uplink-fteid": uplinkFteid,
+		}).Info("PDU Session released after Error Indication")
+		ind, ok := perUe[session.UeCtrl.String()]
+		if !ok {
+			ind = &ErrorIndication{
+				Gnb:    p.Control,
+				Cp:     p.Cp,
+				UeCtrl: session.UeCtrl,
+			}
+			perUe[session.UeCtrl.String()] = ind
+		}
+		ind.Sessions = append(ind.Sessions, session.Session())
+	}
+
+	// notify CP
+	for _, ind := range perUe {
+		if err := p.Client.Post(ctx, p.Cp, "ps/error-indication", ind); err != nil {
+			logrus.WithError(err).WithFields(logrus.Fields{
+				"ue": ind.UeCtrl.String(),
+			}).Error("Could not send ps/error-indication")
+			continue
+		}
+	}
+}
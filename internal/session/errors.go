@@ -13,4 +13,20 @@ var (
 	ErrUnsupportedPDUType      = errors.New("unsupported PDU type")
 	ErrPduSessionNotFound      = errors.New("PDU Session not found")
 	ErrForwardDownlinkNotFound = errors.New("forward downlink rule not found")
+	ErrNoPduSessionIdAvailable = errors.New("no PDU Session ID available")
+	ErrInvalidPduSessionId     = errors.New("invalid PDU Session ID")
+
+	ErrNoPduSessionContainer        = errors.New("no PDU Session Container")
+	ErrMalformedPduSessionContainer = errors.New("malformed PDU Session Container")
+	ErrBitRateExceeded              = errors.New("bit rate exceeded")
+	ErrHeldDownlinkFull             = errors.New("too many held DL packets")
+
+	ErrMissingForwardDownlinkFteid = errors.New("missing forward downlink FTEID")
+	ErrNoHandoverInProgress        = errors.New("no handover in progress")
+	ErrHandoverPreparationFailure  = errors.New("handover preparation failure")
+
+	ErrIllegalTransition = errors.New("procedure not allowed in the current state of the UE")
+
+	ErrNoN3Writer  = errors.New("N3 is not ready")
+	ErrNoN3Address = errors.New("no N3 address matching the PDU Session")
 )
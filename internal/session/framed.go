@@ -0,0 +1,70 @@
+// Copyright Louis Royer and the NextMN contributors. All rights reserved.
+// Use of this source code is governed by a MIT-style license that can be
+// found in the LICENSE file.
+// SPDX-License-Identifier: MIT
+
+package session
+
+import (
+	"context"
+
+	"github.com/nextmn/gnb-lite/internal/metrics"
+
+	"github.com/nextmn/json-api/jsonapi"
+
+	"github.com/sirupsen/logrus"
+)
+
+type macAddr [6]byte
+
+// Writes uplink traffic received in a radio frame identifying the PDU Session.
+// Ethernet frames received with PDU Session ID 0 are mapped to the PDU Session using their source MAC address
+// (learned from previous frames of the PDU Session).
+// When qfi is 0, the QoS Flow is chosen by the gNB.
+func (p *PduSessionsManager) WriteUplinkFramed(ctx context.Context, ue jsonapi.ControlURI, psi uint8, qfi uint8, pkt []byte) error {
+	var session *PduSession
+	if psi != 0 {
+		session, _ = p.tables.ueSessions.Load(ueSessionKey{ue: ue.String(), psi: psi})
+		if session != nil && session.PduSessionType == PduSessionTypeEthernet && len(pkt) >= 14 {
+			p.uplinkMac.Store(macAddr(pkt[6:12]), session)
+		}
+	} else if len(pkt) >= 14 {
+		if s, ok := p.uplinkMac.Load(macAddr(pkt[6:12])); ok && s.(*PduSession).UeCtrl == ue {
+			session = s.(*PduSession)
+		}
+	}
+	if session != nil {
+		session.lock.Lock()
+	}
+	if session == nil || session.UplinkFteid == nil {
+		if session != nil {
+			session.lock.Unlock()
+		}
+		logrus.WithFields(logrus.Fields{
+			"ue":             ue.String(),
+			"pdu-session-id": psi,
+		}).Trace("unknown PDU Session")
+		return ErrPduSessionNotFound
+	}
+	fteid := session.UplinkFteid
+	extHdrs, err := p.uplinkContainer(session, qfi, pkt)
+	session.lock.Unlock()
+	if err != nil {
+		return err
+	}
+	if err := p.ForwardUplink(ctx, session.DownlinkFteid.Addr, pkt, fteid, extHdrs...); err != nil {
+		return err
+	}
+	metrics.Packet(metrics.PathN3Uplink, len(pkt))
+	return nil
+}
+
+// Returns the PDU Session ID to use in radio frames for DL traffic received on this TEID,
+// and true if radio frames are required (non-IP PDU Sessions).
+func (p *PduSessionsManager) RadioFraming(dlTeid uint32) (uint8, bool) {
+	session, ok := p.tables.downlink.Load(dlTeid)
+	if !ok {
+		return 0, false
+	}
+	return session.PduSessionId, !session.PduSessionType.IsIP()
+}
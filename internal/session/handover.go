@@ -0,0 +1,124 @@
+// Copyright Louis Royer and the NextMN contributors. All rights reserved.
+// Use of this source code is governed by a MIT-style license that can be
+// found in the LICENSE file.
+// SPDX-License-Identifier: MIT
+
+package session
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/nextmn/json-api/jsonapi"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Handover types, used as metrics labels
+const (
+	HANDOVER_TYPE_N2 = "n2"
+	HANDOVER_TYPE_XN = "xn"
+)
+
+// Handover prepared by the target gNB, waiting for the Handover Confirm of the UE
+type targetHandover struct {
+	Xn        bool // the Path Switch Request is sent when the UE joins
+	UeCtrl    jsonapi.ControlURI
+	Cp        jsonapi.ControlURI
+	SourcegNB jsonapi.ControlURI
+	TargetgNB jsonapi.ControlURI
+	Sessions  []Session // contains DL FTeid allocated by the target gNB
+	createdAt time.Time
+}
+
+func (s *PduSessions) addHandover(ho targetHandover) {
+	s.hoLock.Lock()
+	defer s.hoLock.Unlock()
+	ho.createdAt = time.Now()
+	s.handovers[ho.UeCtrl.String()] = ho
+}
+
+// Returns the handover prepared for the UE, and removes it
+func (s *PduSessions) popHandover(ue jsonapi.ControlURI) (targetHandover, bool) {
+	s.hoLock.Lock()
+	defer s.hoLock.Unlock()
+	ho, ok := s.handovers[ue.String()]
+	if ok {
+		delete(s.handovers, ue.String())
+	}
+	return ho, ok
+}
+
+// Target gNB: removes PDU Sessions allocated for the handover, and drops DL packets buffered for the UE
+func (s *PduSessions) rollbackHandover(ue jsonapi.ControlURI, sessions []Session) {
+	s.manager.DiscardDownlink(ue)
+	for _, session := range s.manager.RollbackPduSessions(ue, sessions) {
+		logrus.WithFields(logrus.Fields{
+			"ue":             ue.String(),
+			"pdu-session-id": session.PduSessionId,
+			"dl-teid":        session.DownlinkFteid.Teid,
+		}).Info("PDU Session of the handover rolled back")
+	}
+}
+
+// Source gNB: configures forwarding of DL traffic to the target gNB.
+// On error, forwarding already configured for other PDU Sessions is removed.
+func (s *PduSessions) startForwarding(ue jsonapi.ControlURI, sessions []Session) error {
+	for i, session := range sessions {
+		err := ErrMissingForwardDownlinkFteid
+		if session.ForwardDownlinkFteid != nil {
+			err = s.manager.StartForwarding(ue, session, session.ForwardDownlinkFteid)
+		}
+		if err != nil {
+			logrus.WithError(err).WithFields(logrus.Fields{
+				"ue":             ue.String(),
+				"pdu-session-id": session.PduSessionId,
+			}).Error("Could not configure DL forwarding")
+			s.stopForwarding(ue, sessions[:i])
+			return err
+		}
+	}
+	return nil
+}
+
+// Source gNB: removes forwarding of DL traffic; PDU Sessions are kept
+func (s *PduSessions) stopForwarding(ue jsonapi.ControlURI, sessions []Session) {
+	for _, session := range sessions {
+		if err := s.manager.StopForwarding(ue, session); err != nil && !errors.Is(err, ErrForwardDownlinkNotFound) {
+			logrus.WithError(err).WithFields(logrus.Fields{
+				"ue":             ue.String(),
+				"pdu-session-id": session.PduSessionId,
+			}).Error("Could not remove DL forwarding")
+		}
+	}
+}
+
+// Source gNB: cancels an in-progress handover.
+// Forwarding of DL traffic is removed, and the Handover Cancel is sent to the Control Plane
+// (or directly to the target gNB for Xn handover).
+func (s *PduSessions) CancelHandover(ctx context.Context, ue jsonapi.ControlURI, targetgNB jsonapi.ControlURI, xn bool, cause string) {
+	logrus.WithFields(logrus.Fields{
+		"ue":         ue.String(),
+		"target-gnb": targetgNB.String(),
+		"cause":      cause,
+	}).Info("Cancelling handover")
+	s.stopForwarding(ue, s.UeSessions(ue))
+	msg := HandoverCancel{
+		// Header
+		UeCtrl:    ue,
+		Cp:        s.Cp,
+		SourcegNB: s.Control,
+		// Handover Cancel
+		TargetgNB: targetgNB,
+		Cause:     cause,
+	}
+	peer, path := s.Cp, "ps/handover-cancel"
+	if xn {
+		peer, path = targetgNB, "xn/handover-cancel"
+	}
+	if err := s.Client.Post(ctx, peer, path, msg); err != nil {
+		logrus.WithError(err).Error("Could not send " + path)
+		return
+	}
+}
@@ -0,0 +1,91 @@
+// Copyright Louis Royer and the NextMN contributors. All rights reserved.
+// Use of this source code is governed by a MIT-style license that can be
+// found in the LICENSE file.
+// SPDX-License-Identifier: MIT
+
+package session
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/nextmn/json-api/jsonapi"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+func (s *PduSessions) HandoverCancel(c *gin.Context) {
+	var ps HandoverCancel
+	if err := c.BindJSON(&ps); err != nil {
+		logrus.WithError(err).Error("could not deserialize")
+		c.JSON(http.StatusBadRequest, jsonapi.MessageWithError{Message: "could not deserialize", Error: err})
+		return
+	}
+	logrus.WithFields(logrus.Fields{
+		"ue":    ps.UeCtrl.String(),
+		"cause": ps.Cause,
+	}).Info("New Handover Cancel")
+	s.StartProcedure(c, ps.UeCtrl, ProcHandoverCancel, func(_ context.Context, prev UeState) (UeState, error) {
+		if err := s.HandleHandoverCancel(ps); err != nil {
+			return "", err
+		}
+		return s.idleOr(ps.UeCtrl, prev), nil
+	})
+}
+
+// Handover Cancel is send to the target gNB by the Control Plane
+// (or directly by the source gNB for Xn handover).
+// Upon receiving Handover Cancel, the target gNB removes PDU Sessions allocated for the handover,
+// and drops DL packets buffered for the UE.
+func (s *PduSessions) HandleHandoverCancel(ps HandoverCancel) error {
+	ho, ok := s.popHandover(ps.UeCtrl)
+	if !ok {
+		logrus.WithError(ErrNoHandoverInProgress).WithFields(logrus.Fields{
+			"ue": ps.UeCtrl.String(),
+		}).Error("Could not cancel handover")
+		return ErrNoHandoverInProgress
+	}
+	s.rollbackHandover(ps.UeCtrl, ho.Sessions)
+	return nil
+}
+
+func (s *PduSessions) HandoverCancelAck(c *gin.Context) {
+	var ps HandoverCancelAck
+	if err := c.BindJSON(&ps); err != nil {
+		logrus.WithError(err).Error("could not deserialize")
+		c.JSON(http.StatusBadRequest, jsonapi.MessageWithError{Message: "could not deserialize", Error: err})
+		return
+	}
+	logrus.WithFields(logrus.Fields{
+		"ue":         ps.UeCtrl.String(),
+		"target-gnb": ps.TargetgNB.String(),
+	}).Info("Handover cancelled")
+	c.JSON(http.StatusAccepted, jsonapi.Message{Message: "please refer to logs for more information"})
+}
+
+func (s *PduSessions) HandoverPreparationFailure(c *gin.Context) {
+	var ps HandoverPreparationFailure
+	if err := c.BindJSON(&ps); err != nil {
+		logrus.WithError(err).Error("could not deserialize")
+		c.JSON(http.StatusBadRequest, jsonapi.MessageWithError{Message: "could not deserialize", Error: err})
+		return
+	}
+	logrus.WithFields(logrus.Fields{
+		"ue":         ps.UeCtrl.String(),
+		"target-gnb": ps.TargetgNB.String(),
+		"cause":      ps.Cause,
+	}).Error("Handover Preparation Failure")
+	s.StartProcedure(c, ps.UeCtrl, ProcHandoverPreparationFailure, func(context.Context, UeState) (UeState, error) {
+		s.HandleHandoverPreparationFailure(ps)
+		return UeStateConnected, fmt.Errorf("%w: %s", ErrHandoverPreparationFailure, ps.Cause)
+	})
+}
+
+// Handover Preparation Failure is send to the source gNB by the Control Plane
+// (or directly by the target gNB for Xn handover).
+// The UE stays on the source gNB: forwarding of DL traffic is removed, if any.
+func (s *PduSessions) HandleHandoverPreparationFailure(ps HandoverPreparationFailure) {
+	s.stopForwarding(ps.UeCtrl, s.UeSessions(ps.UeCtrl))
+}
@@ -6,19 +6,20 @@
 package session
 
 import (
-	"bytes"
-	"encoding/json"
+	"context"
 	"net/http"
+	"time"
+
+	"github.com/nextmn/gnb-lite/internal/metrics"
 
 	"github.com/nextmn/json-api/jsonapi"
-	"github.com/nextmn/json-api/jsonapi/n1n2"
 
 	"github.com/gin-gonic/gin"
 	"github.com/sirupsen/logrus"
 )
 
 func (s *PduSessions) HandoverConfirm(c *gin.Context) {
-	var ps n1n2.HandoverConfirm
+	var ps HandoverConfirm
 	if err := c.BindJSON(&ps); err != nil {
 		logrus.WithError(err).Error("could not deserialize")
 		c.JSON(http.StatusBadRequest, jsonapi.MessageWithError{Message: "could not deserialize", Error: err})
@@ -27,16 +28,30 @@ func (s *PduSessions) HandoverConfirm(c *gin.Context) {
 	logrus.WithFields(logrus.Fields{
 		"ue": ps.UeCtrl.String(),
 	}).Info("New Handover Confirm")
-	go s.HandleHandoverConfirm(ps)
-	c.JSON(http.StatusAccepted, jsonapi.Message{Message: "please refer to logs for more information"})
+	s.StartProcedure(c, ps.UeCtrl, ProcHandoverConfirm, func(ctx context.Context, _ UeState) (UeState, error) {
+		return s.HandleHandoverConfirm(ctx, ps)
+	})
 }
 
 // Handover Confirm is send by the UE to the target gNB.
-// Upon receiving Handover Confirm, the target gNB send a Handover Notify to the Control Plane.
-func (s *PduSessions) HandleHandoverConfirm(ps n1n2.HandoverConfirm) {
-	ctx := s.Context()
+// Upon receiving Handover Confirm, the target gNB sends buffered DL packets to the UE,
+// and send a Handover Notify to the Control Plane (or a Path Switch Request for Xn handover).
+// Returns the new state of the UE.
+func (s *PduSessions) HandleHandoverConfirm(ctx context.Context, ps HandoverConfirm) (UeState, error) {
+	// the UE has joined: DL packets buffered are sent before DL packets from the direct path
+	s.manager.FlushDownlink(ps.UeCtrl)
+
+	if ho, ok := s.popHandover(ps.UeCtrl); ok {
+		if ho.Xn {
+			metrics.HandoverExecution(HANDOVER_TYPE_XN, time.Since(ho.createdAt))
+			// handover is completed upon reception of the Path Switch Request Ack
+			return UeStateHandoverExecuting, s.sendPathSwitchRequest(ctx, ho)
+		}
+		metrics.HandoverExecution(HANDOVER_TYPE_N2, time.Since(ho.createdAt))
+	}
+
 	// forward to CP
-	resp := n1n2.HandoverNotify{
+	resp := HandoverNotify{
 		// Header
 		UeCtrl:    ps.UeCtrl,
 		Cp:        ps.Cp,
@@ -45,20 +60,9 @@ func (s *PduSessions) HandleHandoverConfirm(ps n1n2.HandoverConfirm) {
 		Sessions:  ps.Sessions,
 		SourceGnb: ps.SourceGnb,
 	}
-	reqBody, err := json.Marshal(resp)
-	if err != nil {
-		logrus.WithError(err).Error("Could not marshal n1n2.HandoverNotify")
-		return
-	}
-	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.Cp.JoinPath("ps/handover-notify").String(), bytes.NewBuffer(reqBody))
-	if err != nil {
-		logrus.WithError(err).Error("Could not create ps/handover-notify")
-		return
-	}
-	req.Header.Set("User-Agent", s.UserAgent)
-	req.Header.Set("Content-Type", "application/json; charset=UTF-8")
-	if _, err := s.Client.Do(req); err != nil {
+	if err := s.Client.Post(ctx, s.Cp, "ps/handover-notify", resp); err != nil {
 		logrus.WithError(err).Error("Could not send ps/handover-notify")
-		return
+		return UeStateConnected, err
 	}
+	return UeStateConnected, nil
 }
@@ -6,19 +6,17 @@
 package session
 
 import (
-	"bytes"
-	"encoding/json"
+	"context"
 	"net/http"
 
 	"github.com/nextmn/json-api/jsonapi"
-	"github.com/nextmn/json-api/jsonapi/n1n2"
 
 	"github.com/gin-gonic/gin"
 	"github.com/sirupsen/logrus"
 )
 
 func (s *PduSessions) HandoverRequest(c *gin.Context) {
-	var ps n1n2.HandoverRequest
+	var ps HandoverRequest
 	if err := c.BindJSON(&ps); err != nil {
 		logrus.WithError(err).Error("could not deserialize")
 		c.JSON(http.StatusBadRequest, jsonapi.MessageWithError{Message: "could not deserialize", Error: err})
@@ -27,34 +25,56 @@ func (s *PduSessions) HandoverRequest(c *gin.Context) {
 	logrus.WithFields(logrus.Fields{
 		"ue": ps.UeCtrl.String(),
 	}).Info("New Handver Request")
-	go s.HandleHandoverRequest(ps)
-	c.JSON(http.StatusAccepted, jsonapi.Message{Message: "please refer to logs for more information"})
+	s.StartProcedure(c, ps.UeCtrl, ProcHandoverRequest, func(ctx context.Context, prev UeState) (UeState, error) {
+		if err := s.HandleHandoverRequest(ctx, ps); err != nil {
+			return s.idleOr(ps.UeCtrl, prev), err
+		}
+		return UeStateHandoverExecuting, nil
+	})
 }
 
 // Handover Request is send to the target gNB by the Control Plane.
 // Upon receiving an Handover Request, the target gNB must allocate DL FTEID,
-// and send it within an Handover Request Ack to the Control Plane.
+// and send it within an Handover Request Ack to the Control Plane
+// (or an Handover Failure when PDU Sessions cannot be allocated).
 // UL FTEID is included in Handover Request and the session
 // can is pre-configured to be ready to be used as soon as Handover Notify is received
-func (s *PduSessions) HandleHandoverRequest(ps n1n2.HandoverRequest) {
-	ctx := s.Context()
+func (s *PduSessions) HandleHandoverRequest(ctx context.Context, ps HandoverRequest) error {
+
+	// forwarded DL packets are buffered until the UE joins
+	s.manager.BufferDownlink(ps.UeCtrl)
 
 	// allocate DL FTEIDs
-	rsp_sessions := make([]n1n2.Session, len(ps.Sessions))
+	rsp_sessions := make([]Session, len(ps.Sessions))
 	copy(rsp_sessions, ps.Sessions)
 	for i, session := range ps.Sessions {
 		// allocate DL FTEID, and configure UL FTEID
-		downlinkFTeid, err := s.manager.NewPduSession(ctx, session.Addr, ps.UeCtrl, session.UplinkFteid)
+		pduSession, err := s.manager.NewPduSession(ctx, ps.UeCtrl, session)
 		if err != nil {
 			logrus.WithError(err).Error("Could create PDU Session")
-			// TODO: notify CP of the error
-			return
+			s.rollbackHandover(ps.UeCtrl, rsp_sessions[:i])
+			s.sendHandoverFailure(ctx, ps, err.Error())
+			return err
+		}
+		rsp_sessions[i].DownlinkFteid = pduSession.DownlinkFteid
+		rsp_sessions[i].PduSessionId = pduSession.PduSessionId
+		// DL traffic from the direct path is held until forwarded DL traffic is finished
+		if err := s.manager.AwaitEndMarker(pduSession.DownlinkFteid.Teid); err != nil {
+			logrus.WithError(err).Error("Could not wait for End Marker")
 		}
-		rsp_sessions[i].DownlinkFteid = downlinkFTeid
 	}
 
+	// the Handover Notify will be sent when the UE joins
+	s.addHandover(targetHandover{
+		UeCtrl:    ps.UeCtrl,
+		Cp:        ps.Cp,
+		SourcegNB: ps.SourcegNB,
+		TargetgNB: ps.TargetgNB,
+		Sessions:  rsp_sessions,
+	})
+
 	// notify CP
-	rsp := n1n2.HandoverRequestAck{
+	rsp := HandoverRequestAck{
 		// Header
 		Cp:        ps.Cp,
 		TargetgNB: ps.TargetgNB,
@@ -64,20 +84,26 @@ func (s *PduSessions) HandleHandoverRequest(ps n1n2.HandoverRequest) {
 		SourcegNB: ps.SourcegNB,
 	}
 
-	reqBody, err := json.Marshal(rsp)
-	if err != nil {
-		logrus.WithError(err).Error("Could not marshal n1n2.HandoverRequestAck")
-		return
+	if err := s.Client.Post(ctx, s.Cp, "ps/handover-request-ack", rsp); err != nil {
+		logrus.WithError(err).Error("Could not send ps/handover-request-ack")
+		return err
 	}
-	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.Cp.JoinPath("ps/handover-request-ack").String(), bytes.NewBuffer(reqBody))
-	if err != nil {
-		logrus.WithError(err).Error("Could not create ps/handover-request-ack")
-		return
+	return nil
+}
+
+// Target gNB: resources for the handover could not be allocated
+func (s *PduSessions) sendHandoverFailure(ctx context.Context, ps HandoverRequest, cause string) {
+	rsp := HandoverFailure{
+		// Header
+		UeCtrl:    ps.UeCtrl,
+		Cp:        ps.Cp,
+		TargetgNB: ps.TargetgNB,
+		// Handover Failure
+		SourcegNB: ps.SourcegNB,
+		Cause:     cause,
 	}
-	req.Header.Set("User-Agent", s.UserAgent)
-	req.Header.Set("Content-Type", "application/json; charset=UTF-8")
-	if _, err := s.Client.Do(req); err != nil {
-		logrus.WithError(err).Error("Could not send ps/handover-request-ack")
+	if err := s.Client.Post(ctx, s.Cp, "ps/handover-failure", rsp); err != nil {
+		logrus.WithError(err).Error("Could not send ps/handover-failure")
 		return
 	}
 }
@@ -0,0 +1,301 @@
+// Copyright Louis Royer and the NextMN contributors. All rights reserved.
+// Use of this source code is governed by a MIT-style license that can be
+// found in the LICENSE file.
+// SPDX-License-Identifier: MIT
+
+package session
+
+import (
+	"net/netip"
+
+	"github.com/nextmn/json-api/jsonapi"
+	"github.com/nextmn/json-api/jsonapi/n1n2"
+)
+
+// Messages of this file are extensions of github.com/nextmn/json-api/jsonapi/n1n2 messages.
+// They are wire-compatible with the original messages: additional fields are optional,
+// and ignored by peers not supporting them.
+
+type PduSessionType string
+
+const (
+	PduSessionTypeIPv4         PduSessionType = "ipv4"
+	PduSessionTypeIPv6         PduSessionType = "ipv6"
+	PduSessionTypeIPv4v6       PduSessionType = "ipv4v6"
+	PduSessionTypeEthernet     PduSessionType = "ethernet"
+	PduSessionTypeUnstructured PduSessionType = "unstructured"
+)
+
+// Returns true for IPv4, IPv6 and IPv4v6 PDU Sessions (default when the type is not specified)
+func (t PduSessionType) IsIP() bool {
+	return t != PduSessionTypeEthernet && t != PduSessionTypeUnstructured
+}
+
+// Single Network Slice Selection Assistance Information
+type Snssai struct {
+	Sst uint8  `json:"sst"`          // Slice/Service Type
+	Sd  string `json:"sd,omitempty"` // Slice Differentiator (hex string)
+}
+
+// QoS Flow of a PDU Session
+type QosFlow struct {
+	Qfi     uint8    `json:"qfi"`               // QoS Flow Identifier
+	Default bool     `json:"default,omitempty"` // QoS Flow of the default QoS rule
+	Gfbr    *BitRate `json:"gfbr,omitempty"`    // Guaranteed Flow Bit Rate (GBR QoS Flows only)
+	Mfbr    *BitRate `json:"mfbr,omitempty"`    // Maximum Flow Bit Rate: traffic exceeding it is dropped
+}
+
+// QoS rule of a PDU Session, used to map UL traffic to a QoS Flow
+type QosRule struct {
+	Precedence    uint8          `json:"precedence"` // rules with lower values are evaluated first
+	Qfi           uint8          `json:"qfi"`
+	PacketFilters []PacketFilter `json:"packet-filters,omitempty"` // the rule matches when any packet filter matches (any packet without packet filter)
+}
+
+type Session struct {
+	n1n2.Session
+
+	// IPv6 prefix (/64) attributed to the UE for this PDU Session (IPv6 or IPv4v6 PDU Session)
+	Ipv6Prefix *netip.Prefix `json:"ue-ipv6-prefix,omitempty"`
+
+	// PDU Session ID and type, as requested by the UE
+	PduSessionId   uint8          `json:"pdu-session-id,omitempty"`
+	PduSessionType PduSessionType `json:"pdu-session-type,omitempty"`
+	Snssai         *Snssai        `json:"s-nssai,omitempty"`
+
+	// QoS Flows and QoS rules of the PDU Session
+	QosFlows []QosFlow `json:"qos-flows,omitempty"`
+	QosRules []QosRule `json:"qos-rules,omitempty"`
+
+	// Session-AMBR: Non-GBR traffic exceeding it is dropped
+	SessionAmbr *BitRate `json:"session-ambr,omitempty"`
+}
+
+type PduSessionEstabReqMsg struct {
+	n1n2.PduSessionEstabReqMsg
+
+	// PDU Session ID and type, chosen by the UE
+	// (when the PDU Session ID is not provided, it is allocated by the gNB)
+	PduSessionId   uint8          `json:"pdu-session-id,omitempty"`
+	PduSessionType PduSessionType `json:"pdu-session-type,omitempty"`
+	Snssai         *Snssai        `json:"s-nssai,omitempty"`
+}
+
+type PduSessionEstabAcceptMsg struct {
+	Header PduSessionEstabReqMsg `json:"header"`  // copy of the PDU Session Establishment Request Message
+	Addr   netip.Addr            `json:"address"` // IP Address attributed to the UE for this PDU Session
+
+	// IPv6 prefix (/64) attributed to the UE for this PDU Session (IPv6 or IPv4v6 PDU Session)
+	Ipv6Prefix *netip.Prefix `json:"ipv6-prefix,omitempty"`
+}
+
+type N2PduSessionReqMsg struct {
+	Cp     jsonapi.ControlURI       `json:"cp"`
+	UeInfo PduSessionEstabAcceptMsg `json:"ue-info"` // information to forward to the UE
+
+	// Uplink FTEID: the gNB will establish an Uplink GTP Tunnel using the following
+	UplinkFteid jsonapi.Fteid `json:"uplink-fteid"`
+
+	// QoS Flows: UL traffic is sent with a PDU Session Container indicating its QFI
+	QosFlows []QosFlow `json:"qos-flows,omitempty"`
+	QosRules []QosRule `json:"qos-rules,omitempty"` // used to choose the QFI of UL traffic
+
+	// Non-GBR traffic exceeding AMBRs is dropped (the UE-AMBR replaces the previous UE-AMBR of the UE)
+	SessionAmbr *BitRate `json:"session-ambr,omitempty"`
+	UeAmbr      *BitRate `json:"ue-ambr,omitempty"`
+}
+
+type N2PduSessionRespMsg struct {
+	UeInfo PduSessionEstabAcceptMsg `json:"ue-info"` // used to identify the PDU Session
+
+	// Downlink FTEID: the CP will use this to configure a downlink GTP Tunnel in Upf-i
+	DownlinkFteid jsonapi.Fteid `json:"downlink-fteid"`
+}
+
+type HandoverRequired struct {
+	// Header
+	SourcegNB jsonapi.ControlURI `json:"source-gnb"`
+	Cp        jsonapi.ControlURI `json:"cp"`
+
+	// Handover Required content
+	Ue                 jsonapi.ControlURI `json:"ue"`
+	Sessions           []Session          `json:"sessions"` // list of all pdu sessions of the UE to be moved
+	TargetgNB          jsonapi.ControlURI `json:"target-gnb"`
+	IndirectForwarding bool               `json:"indirect-forwarding"`
+}
+
+type HandoverRequest struct {
+	// Header
+	UeCtrl    jsonapi.ControlURI `json:"ue-ctrl"`
+	Cp        jsonapi.ControlURI `json:"cp"`
+	TargetgNB jsonapi.ControlURI `json:"target-gnb"`
+
+	// Handover Request
+	SourcegNB jsonapi.ControlURI `json:"source-gnb"`
+	Sessions  []Session          `json:"sessions"` // contains new UL FTeid
+}
+
+type HandoverRequestAck struct {
+	// Header
+	Cp        jsonapi.ControlURI `json:"cp"`
+	TargetgNB jsonapi.ControlURI `json:"target-gnb"`
+
+	// Handover Request Ack
+	SourcegNB jsonapi.ControlURI `json:"source-gnb"`
+	UeCtrl    jsonapi.ControlURI `json:"ue-ctrl"`
+	Sessions  []Session          `json:"sessions"` // contains new DL FTeid
+}
+
+type HandoverCommand struct {
+	// Header
+	UeCtrl    jsonapi.ControlURI `json:"ue-ctrl"`
+	Cp        jsonapi.ControlURI `json:"cp"`
+	SourceGnb jsonapi.ControlURI `json:"source-gnb"`
+
+	// Handover Command
+	Sessions  []Session          `json:"sessions"` // contains new ForwardDownlinkFteid
+	TargetGnb jsonapi.ControlURI `json:"target-gnb"`
+}
+
+type HandoverConfirm struct {
+	// Header
+	UeCtrl jsonapi.ControlURI `json:"ue-ctrl"`
+	Cp     jsonapi.ControlURI `json:"cp"`
+
+	// Handover Confirm
+	Sessions  []Session          `json:"sessions"`
+	SourceGnb jsonapi.ControlURI `json:"source-gnb"`
+	TargetGnb jsonapi.ControlURI `json:"target-gnb"`
+}
+
+type HandoverNotify struct {
+	// Header
+	UeCtrl    jsonapi.ControlURI `json:"ue-ctrl"`
+	Cp        jsonapi.ControlURI `json:"cp"`
+	TargetGnb jsonapi.ControlURI `json:"target-gnb"`
+
+	// Handover Notify
+	Sessions  []Session          `json:"sessions"`
+	SourceGnb jsonapi.ControlURI `json:"source-gnb"`
+}
+
+// Xn handover: the source gNB and the target gNB communicate directly,
+// and the target gNB requests the path switch to the Control Plane.
+
+type XnHandoverRequest struct {
+	// Header
+	UeCtrl    jsonapi.ControlURI `json:"ue-ctrl"`
+	Cp        jsonapi.ControlURI `json:"cp"`
+	SourcegNB jsonapi.ControlURI `json:"source-gnb"`
+
+	// Xn Handover Request
+	TargetgNB jsonapi.ControlURI `json:"target-gnb"`
+	Sessions  []Session          `json:"sessions"` // contains current UL FTeid
+}
+
+type XnHandoverRequestAck struct {
+	// Header
+	UeCtrl    jsonapi.ControlURI `json:"ue-ctrl"`
+	Cp        jsonapi.ControlURI `json:"cp"`
+	TargetgNB jsonapi.ControlURI `json:"target-gnb"`
+
+	// Xn Handover Request Ack
+	SourcegNB jsonapi.ControlURI `json:"source-gnb"`
+	Sessions  []Session          `json:"sessions"` // contains new DL FTeid, and ForwardDownlinkFteid
+}
+
+type XnSnStatusTransfer struct {
+	// Header
+	UeCtrl    jsonapi.ControlURI `json:"ue-ctrl"`
+	SourcegNB jsonapi.ControlURI `json:"source-gnb"`
+
+	// SN Status Transfer
+	TargetgNB jsonapi.ControlURI `json:"target-gnb"`
+	Sessions  []SnStatus         `json:"sessions"`
+}
+
+// Status of a PDU Session transferred by the source gNB
+// (gNB-Lite has no PDCP: QoS Flow packet counters are used instead of PDCP SNs)
+type SnStatus struct {
+	PduSessionId uint8  `json:"pdu-session-id"`
+	UlCount      uint64 `json:"ul-count"` // UL packets sent to the UPF by the source gNB
+	DlCount      uint64 `json:"dl-count"` // DL packets received by the source gNB
+}
+
+type XnUeContextRelease struct {
+	// Header
+	UeCtrl    jsonapi.ControlURI `json:"ue-ctrl"`
+	TargetgNB jsonapi.ControlURI `json:"target-gnb"`
+
+	// UE Context Release
+	SourcegNB jsonapi.ControlURI `json:"source-gnb"`
+	Sessions  []Session          `json:"sessions"`
+}
+
+type PathSwitchRequest struct {
+	// Header
+	UeCtrl    jsonapi.ControlURI `json:"ue-ctrl"`
+	Cp        jsonapi.ControlURI `json:"cp"`
+	TargetgNB jsonapi.ControlURI `json:"target-gnb"`
+
+	// Path Switch Request
+	SourcegNB jsonapi.ControlURI `json:"source-gnb"`
+	Sessions  []Session          `json:"sessions"` // contains new DL FTeid
+}
+
+type PathSwitchRequestAck struct {
+	// Header
+	UeCtrl    jsonapi.ControlURI `json:"ue-ctrl"`
+	Cp        jsonapi.ControlURI `json:"cp"`
+	TargetgNB jsonapi.ControlURI `json:"target-gnb"`
+
+	// Path Switch Request Ack
+	SourcegNB jsonapi.ControlURI `json:"source-gnb"`
+	Sessions  []Session          `json:"sessions"` // may contain new UL FTeid
+}
+
+// Handover failure and cancellation: the target gNB rolls back the PDU Sessions it allocated,
+// and the source gNB stops forwarding DL traffic.
+
+type HandoverFailure struct {
+	// Header
+	UeCtrl    jsonapi.ControlURI `json:"ue-ctrl"`
+	Cp        jsonapi.ControlURI `json:"cp"`
+	TargetgNB jsonapi.ControlURI `json:"target-gnb"`
+
+	// Handover Failure
+	SourcegNB jsonapi.ControlURI `json:"source-gnb"`
+	Cause     string             `json:"cause"`
+}
+
+type HandoverPreparationFailure struct {
+	// Header
+	UeCtrl    jsonapi.ControlURI `json:"ue-ctrl"`
+	Cp        jsonapi.ControlURI `json:"cp"`
+	SourcegNB jsonapi.ControlURI `json:"source-gnb"`
+
+	// Handover Preparation Failure
+	TargetgNB jsonapi.ControlURI `json:"target-gnb"`
+	Cause     string             `json:"cause"`
+}
+
+type HandoverCancel struct {
+	// Header
+	UeCtrl    jsonapi.ControlURI `json:"ue-ctrl"`
+	Cp        jsonapi.ControlURI `json:"cp"`
+	SourcegNB jsonapi.ControlURI `json:"source-gnb"`
+
+	// Handover Cancel
+	TargetgNB jsonapi.ControlURI `json:"target-gnb"`
+	Cause     string             `json:"cause"`
+}
+
+type HandoverCancelAck struct {
+	// Header
+	UeCtrl    jsonapi.ControlURI `json:"ue-ctrl"`
+	Cp        jsonapi.ControlURI `json:"cp"`
+	SourcegNB jsonapi.ControlURI `json:"source-gnb"`
+
+	// Handover Cancel Ack
+	TargetgNB jsonapi.ControlURI `json:"target-gnb"`
+}
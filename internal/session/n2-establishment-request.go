@@ -6,8 +6,7 @@
 package session
 
 import (
-	"bytes"
-	"encoding/json"
+	"context"
 	"net/http"
 
 	"github.com/nextmn/json-api/jsonapi"
@@ -19,7 +18,7 @@ import (
 
 // request from CP
 func (p *PduSessions) N2EstablishmentRequest(c *gin.Context) {
-	var ps n1n2.N2PduSessionReqMsg
+	var ps N2PduSessionReqMsg
 	if err := c.BindJSON(&ps); err != nil {
 		logrus.WithError(err).Error("could not deserialize")
 		c.JSON(http.StatusBadRequest, jsonapi.MessageWithError{Message: "could not deserialize", Error: err})
@@ -30,59 +29,55 @@ func (p *PduSessions) N2EstablishmentRequest(c *gin.Context) {
 		"upf":         ps.UplinkFteid.Addr,
 		"uplink-teid": ps.UplinkFteid.Teid,
 	}).Info("New PDU Session establishment Request")
-	go p.HandleN2EstablishmentRequest(ps)
-	c.JSON(http.StatusAccepted, jsonapi.Message{Message: "please refer to logs for more information"})
+	p.StartProcedure(c, ps.UeInfo.Header.Ue, ProcN2EstablishmentRequest, func(ctx context.Context, _ UeState) (UeState, error) {
+		err := p.HandleN2EstablishmentRequest(ctx, ps)
+		return p.idleOr(ps.UeInfo.Header.Ue, UeStateConnected), err
+	})
 }
 
-func (p *PduSessions) HandleN2EstablishmentRequest(ps n1n2.N2PduSessionReqMsg) {
-	ctx := p.Context()
+func (p *PduSessions) HandleN2EstablishmentRequest(ctx context.Context, ps N2PduSessionReqMsg) error {
 	// allocate downlink teid
-	downlinkFteid, err := p.manager.NewPduSession(ctx, ps.UeInfo.Addr, ps.UeInfo.Header.Ue, &ps.UplinkFteid)
+	pduSession, err := p.manager.NewPduSession(ctx, ps.UeInfo.Header.Ue, Session{
+		Session: n1n2.Session{
+			Addr:        ps.UeInfo.Addr,
+			Dnn:         ps.UeInfo.Header.Dnn,
+			UplinkFteid: &ps.UplinkFteid,
+		},
+		Ipv6Prefix:     ps.UeInfo.Ipv6Prefix,
+		PduSessionId:   ps.UeInfo.Header.PduSessionId,
+		PduSessionType: ps.UeInfo.Header.PduSessionType,
+		Snssai:         ps.UeInfo.Header.Snssai,
+		QosFlows:       ps.QosFlows,
+		QosRules:       ps.QosRules,
+		SessionAmbr:    ps.SessionAmbr,
+	})
 	if err != nil {
 		logrus.WithError(err).Error("Could create PDU Session")
 		// TODO: notify CP of the error
-		return
+		return err
 	}
-
-	// send PseAccept to UE
-	reqBody, err := json.Marshal(ps.UeInfo)
-	if err != nil {
-		logrus.WithError(err).Error("Could not marshal UeInfo")
-		return
+	if ps.UeAmbr != nil {
+		if err := p.manager.SetUeAmbr(ps.UeInfo.Header.Ue, ps.UeAmbr); err != nil {
+			logrus.WithError(err).Error("Could not set UE-AMBR")
+		}
 	}
+	// PDU Session ID may have been allocated by the gNB
+	ps.UeInfo.Header.PduSessionId = pduSession.PduSessionId
 
-	req, err := http.NewRequestWithContext(ctx, http.MethodPost, ps.UeInfo.Header.Ue.JoinPath("ps/establishment-accept").String(), bytes.NewBuffer(reqBody))
-	if err != nil {
-		logrus.WithError(err).Error("Could not create request for ps/establishment-accept")
-		return
-	}
-	req.Header.Set("User-Agent", p.UserAgent)
-	req.Header.Set("Content-Type", "application/json; charset=UTF-8")
-	if _, err := p.Client.Do(req); err != nil {
+	// send PseAccept to UE
+	if err := p.Client.Post(ctx, ps.UeInfo.Header.Ue, "ps/establishment-accept", ps.UeInfo); err != nil {
 		logrus.WithError(err).Error("Could not send ps/establishment-accept")
-		return
+		return err
 	}
 
-	psresp := n1n2.N2PduSessionRespMsg{
+	psresp := N2PduSessionRespMsg{
 		UeInfo:        ps.UeInfo,
-		DownlinkFteid: *downlinkFteid,
+		DownlinkFteid: *pduSession.DownlinkFteid,
 	}
 	// send N2PsResp to CP (with dl fteid)
-	n2reqBody, err := json.Marshal(psresp)
-	if err != nil {
-		logrus.WithError(err).Error("Could not marshal n1n2.N2PduSessionRespMs")
-		return
+	if err := p.Client.Post(ctx, ps.Cp, "ps/n2-establishment-response", psresp); err != nil {
+		logrus.WithError(err).Error("Could not send ps/n2-establishment-response")
+		return err
 	}
-	req2, err := http.NewRequestWithContext(ctx, http.MethodPost, ps.Cp.JoinPath("ps/n2-establishment-response").String(), bytes.NewBuffer(n2reqBody))
-	if err != nil {
-		logrus.WithError(err).Error("Could not create request for ps/n2-establishment-response")
-		return
-	}
-	req2.Header.Set("User-Agent", p.UserAgent)
-	req2.Header.Set("Content-Type", "application/json; charset=UTF-8")
-	if _, err := p.Client.Do(req2); err != nil {
-		logrus.WithError(err).Error("Could not create send request for ps/n2-establishment-response")
-		return
-	}
-
+	return nil
 }
@@ -0,0 +1,132 @@
+// Copyright Louis Royer and the NextMN contributors. All rights reserved.
+// Use of this source code is governed by a MIT-style license that can be
+// found in the LICENSE file.
+// SPDX-License-Identifier: MIT
+
+package session
+
+import (
+	"net/netip"
+	"slices"
+	"strings"
+
+	"github.com/nextmn/json-api/jsonapi"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Sends GTP-U messages on N3
+type N3Writer interface {
+	WriteToUDPAddrPort(b []byte, addr netip.AddrPort) (int, error)
+}
+
+// N3 address of the gNB (GTP-U over IPv4 or IPv6).
+// When rules are set, the address is only selected for PDU Sessions matching each of them.
+type N3Address struct {
+	Addr   netip.Addr
+	Upfs   []netip.Prefix // UPF addresses (uplink FTEID)
+	Dnns   []string
+	Slices []Snssai // a Slice Differentiator is only compared when set
+}
+
+func (a *N3Address) hasRules() bool {
+	return len(a.Upfs) > 0 || len(a.Dnns) > 0 || len(a.Slices) > 0
+}
+
+func (a *N3Address) matches(upf netip.Addr, dnn string, snssai *Snssai) bool {
+	if len(a.Upfs) > 0 && !slices.ContainsFunc(a.Upfs, func(p netip.Prefix) bool { return p.Contains(upf) }) {
+		return false
+	}
+	if len(a.Dnns) > 0 && !slices.Contains(a.Dnns, dnn) {
+		return false
+	}
+	if len(a.Slices) > 0 && (snssai == nil || !slices.ContainsFunc(a.Slices, func(s Snssai) bool {
+		return s.Sst == snssai.Sst && (s.Sd == "" || strings.EqualFold(s.Sd, snssai.Sd))
+	})) {
+		return false
+	}
+	return true
+}
+
+// Selects the N3 address used for a PDU Session with the UPF (invalid when unknown).
+// Only addresses of the IP version of the UPF are considered: the first one with matching rules is selected,
+// otherwise the first one without rules. When each of them has rules that do not match, the PDU Session is rejected.
+func (p *PduSessionsManager) selectN3Addr(upf netip.Addr, dnn string, snssai *Snssai) (netip.Addr, error) {
+	upf = upf.Unmap()
+	var noRules netip.Addr
+	sameVersion := false
+	for _, a := range p.n3 {
+		if upf.IsValid() && a.Addr.Is4() != upf.Is4() {
+			continue
+		}
+		sameVersion = true
+		if !a.hasRules() {
+			if !noRules.IsValid() {
+				noRules = a.Addr
+			}
+		} else if a.matches(upf, dnn, snssai) {
+			return a.Addr, nil
+		}
+	}
+	if noRules.IsValid() {
+		return noRules, nil
+	}
+	if sameVersion {
+		logrus.WithFields(logrus.Fields{
+			"upf":    upf,
+			"dnn":    dnn,
+			"snssai": snssai,
+		}).Warn("No N3 address matching the PDU Session")
+		return netip.Addr{}, ErrNoN3Address
+	}
+	logrus.WithFields(logrus.Fields{
+		"upf": upf,
+	}).Warn("No N3 address of the IP version of the UPF")
+	return p.n3[0].Addr, nil
+}
+
+// Returns the first N3 address of the IP version of the peer (invalid when there is none)
+func (p *PduSessionsManager) n3AddrOfVersion(peer netip.Addr) netip.Addr {
+	for _, a := range p.n3 {
+		if a.Addr.Is4() == peer.Unmap().Is4() {
+			return a.Addr
+		}
+	}
+	return netip.Addr{}
+}
+
+// Set the writer used to send GTP-U messages from the N3 address (shared with the GTP-U listener)
+// It must be set before packets are handled.
+func (p *PduSessionsManager) SetN3Writer(addr netip.Addr, w N3Writer) {
+	p.Lock()
+	defer p.Unlock()
+	p.n3Writers[addr] = w
+}
+
+// Sends a GTP-U message to the peer of the tunnel, from the N3 address src
+// (when src is not a N3 address of the IP version of the peer, another N3 address of this IP version is used)
+func (p *PduSessionsManager) writeN3(src netip.Addr, fteid *jsonapi.Fteid, msg interface {
+	MarshalLen() int
+	MarshalTo([]byte) error
+}) error {
+	w, ok := p.n3Writers[src]
+	if !ok || src.Is4() != fteid.Addr.Unmap().Is4() {
+		w, ok = p.n3Writers[p.n3AddrOfVersion(fteid.Addr)]
+		if !ok {
+			return ErrNoN3Writer
+		}
+	}
+	buf := p.n3Buffers.Get()
+	defer p.n3Buffers.Put(buf)
+	b := *buf
+	if l := msg.MarshalLen(); l > len(b) {
+		b = make([]byte, l)
+	} else {
+		b = b[:l]
+	}
+	if err := msg.MarshalTo(b); err != nil {
+		return err
+	}
+	_, err := w.WriteToUDPAddrPort(b, netip.AddrPortFrom(fteid.Addr, GTPU_PORT))
+	return err
+}
@@ -0,0 +1,120 @@
+// Copyright Louis Royer and the NextMN contributors. All rights reserved.
+// Use of this source code is governed by a MIT-style license that can be
+// found in the LICENSE file.
+// SPDX-License-Identifier: MIT
+
+package session
+
+import (
+	"context"
+	"errors"
+	"net/netip"
+	"testing"
+
+	"github.com/nextmn/json-api/jsonapi"
+	"github.com/nextmn/json-api/jsonapi/n1n2"
+)
+
+// Records destinations of GTP-U messages sent from a N3 address
+type recordN3Writer struct {
+	dst []netip.AddrPort
+}
+
+func (w *recordN3Writer) WriteToUDPAddrPort(b []byte, addr netip.AddrPort) (int, error) {
+	w.dst = append(w.dst, addr)
+	return len(b), nil
+}
+
+// Forwarded packets are sent from a N3 address of the IP version of the peer
+func TestForwardUplinkIpVersion(t *testing.T) {
+	gnb4 := netip.MustParseAddr("198.51.100.10")
+	gnb6 := netip.MustParseAddr("2001:db8::10")
+	p := NewPduSessionsManager([]N3Address{{Addr: gnb4}, {Addr: gnb6}}, 0, 0)
+	writers := map[netip.Addr]*recordN3Writer{gnb4: {}, gnb6: {}}
+	for addr, w := range writers {
+		p.SetN3Writer(addr, w)
+	}
+
+	for _, tc := range []struct {
+		name string
+		src  netip.Addr
+		peer netip.Addr
+		from netip.Addr
+	}{
+		{name: "ipv4 to ipv4", src: gnb4, peer: netip.MustParseAddr("198.51.100.20"), from: gnb4},
+		{name: "ipv6 to ipv6", src: gnb6, peer: netip.MustParseAddr("2001:db8::20"), from: gnb6},
+		{name: "ipv4 to ipv6", src: gnb4, peer: netip.MustParseAddr("2001:db8::20"), from: gnb6},
+		{name: "ipv6 to ipv4", src: gnb6, peer: netip.MustParseAddr("198.51.100.20"), from: gnb4},
+		{name: "ipv6 to ipv4-mapped ipv6", src: gnb6, peer: netip.MustParseAddr("::ffff:198.51.100.20"), from: gnb4},
+		{name: "unknown source", src: netip.Addr{}, peer: netip.MustParseAddr("2001:db8::20"), from: gnb6},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			for _, w := range writers {
+				w.dst = nil
+			}
+			if err := p.ForwardUplink(context.Background(), tc.src, uplinkPacket(netip.MustParseAddr("10.0.0.1")), jsonapi.NewFteid(tc.peer, 1)); err != nil {
+				t.Fatal(err)
+			}
+			for addr, w := range writers {
+				want := 0
+				if addr == tc.from {
+					want = 1
+				}
+				if len(w.dst) != want {
+					t.Errorf("%d messages sent from %s, expected %d", len(w.dst), addr, want)
+				}
+			}
+		})
+	}
+}
+
+// PDU Sessions not matching the rules of any N3 address of the IP version of the UPF are rejected
+func TestSelectN3Addr(t *testing.T) {
+	gnb4 := netip.MustParseAddr("198.51.100.10")
+	gnb4Ims := netip.MustParseAddr("198.51.101.10")
+	gnb6 := netip.MustParseAddr("2001:db8::10")
+	upf4 := netip.MustParseAddr("198.51.100.1")
+	upf6 := netip.MustParseAddr("2001:db8::1")
+	ue, err := jsonapi.ParseControlURI("http://192.0.2.1:8080")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct {
+		name string
+		n3   []N3Address
+		upf  netip.Addr
+		dnn  string
+		want netip.Addr
+		err  error
+	}{
+		{name: "matching rules", n3: []N3Address{{Addr: gnb4}, {Addr: gnb4Ims, Dnns: []string{"ims"}}}, upf: upf4, dnn: "ims", want: gnb4Ims},
+		{name: "no rules", n3: []N3Address{{Addr: gnb4Ims, Dnns: []string{"ims"}}, {Addr: gnb4}}, upf: upf4, dnn: "internet", want: gnb4},
+		{name: "ip version of the upf", n3: []N3Address{{Addr: gnb4}, {Addr: gnb6}}, upf: upf6, dnn: "internet", want: gnb6},
+		{name: "rules not matching", n3: []N3Address{{Addr: gnb4Ims, Dnns: []string{"ims"}}, {Addr: gnb6}}, upf: upf4, dnn: "internet", err: ErrNoN3Address},
+		{name: "no address of the ip version of the upf", n3: []N3Address{{Addr: gnb4}}, upf: upf6, dnn: "internet", want: gnb4},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			p := NewPduSessionsManager(tc.n3, 0, 0)
+			ps, err := p.NewPduSession(context.Background(), *ue, Session{
+				Session: n1n2.Session{
+					Addr:        netip.MustParseAddr("10.0.0.1"),
+					Dnn:         tc.dnn,
+					UplinkFteid: jsonapi.NewFteid(tc.upf, 1),
+				},
+				PduSessionId: 1,
+			})
+			if !errors.Is(err, tc.err) {
+				t.Fatalf("error %v, expected %v", err, tc.err)
+			}
+			if err != nil {
+				if p.HasUeContext(*ue) {
+					t.Error("UE context created for a rejected PDU Session")
+				}
+				return
+			}
+			if ps.DownlinkFteid.Addr != tc.want {
+				t.Errorf("DL FTEID address %s, expected %s", ps.DownlinkFteid.Addr, tc.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,132 @@
+// Copyright Louis Royer and the NextMN contributors. All rights reserved.
+// Use of this source code is governed by a MIT-style license that can be
+// found in the LICENSE file.
+// SPDX-License-Identifier: MIT
+
+package session
+
+import (
+	"encoding/binary"
+	"net/netip"
+)
+
+const (
+	IP_PROTO_TCP  = 6
+	IP_PROTO_UDP  = 17
+	IP_PROTO_SCTP = 132
+)
+
+type PortRange struct {
+	Low  uint16 `json:"low"`
+	High uint16 `json:"high"`
+}
+
+// Returns true if the port is in the range (an empty range matches any port)
+func (r PortRange) contains(port uint16) bool {
+	if r.Low == 0 && r.High == 0 {
+		return true
+	}
+	return port >= r.Low && port <= r.High
+}
+
+// Packet filter of a QoS rule (TS 24.501). Fields are matched against UL traffic:
+// local is the UE side, and remote is the DN side. Zero values match anything.
+type PacketFilter struct {
+	LocalPrefix  netip.Prefix `json:"local-prefix,omitzero"`
+	RemotePrefix netip.Prefix `json:"remote-prefix,omitzero"`
+	Protocol     uint8        `json:"protocol,omitempty"` // IP protocol number (next header for IPv6)
+	LocalPorts   PortRange    `json:"local-ports,omitzero"`
+	RemotePorts  PortRange    `json:"remote-ports,omitzero"`
+	Dscp         *uint8       `json:"dscp,omitempty"`
+}
+
+// 5-tuple and DSCP of an IP packet, from the point of view of the UE
+type fiveTuple struct {
+	local      netip.Addr
+	remote     netip.Addr
+	protocol   uint8
+	localPort  uint16
+	remotePort uint16
+}
+
+func (f *PacketFilter) matches(t fiveTuple, dscp uint8) bool {
+	if f.LocalPrefix.IsValid() && !f.LocalPrefix.Contains(t.local) {
+		return false
+	}
+	if f.RemotePrefix.IsValid() && !f.RemotePrefix.Contains(t.remote) {
+		return false
+	}
+	if f.Protocol != 0 && f.Protocol != t.protocol {
+		return false
+	}
+	if !f.LocalPorts.contains(t.localPort) || !f.RemotePorts.contains(t.remotePort) {
+		return false
+	}
+	if f.Dscp != nil && *f.Dscp != dscp {
+		return false
+	}
+	return true
+}
+
+// Returns the packet filter matching exactly this 5-tuple
+func (t fiveTuple) filter() PacketFilter {
+	f := PacketFilter{
+		LocalPrefix:  netip.PrefixFrom(t.local, t.local.BitLen()),
+		RemotePrefix: netip.PrefixFrom(t.remote, t.remote.BitLen()),
+		Protocol:     t.protocol,
+	}
+	if t.localPort != 0 || t.remotePort != 0 {
+		f.LocalPorts = PortRange{Low: t.localPort, High: t.localPort}
+		f.RemotePorts = PortRange{Low: t.remotePort, High: t.remotePort}
+	}
+	return f
+}
+
+// Returns the 5-tuple and the DSCP of an IPv4 or IPv6 packet.
+// When uplink is false, the packet is a DL packet: source and destination are mirrored.
+func parseFiveTuple(pkt []byte, uplink bool) (fiveTuple, uint8, bool) {
+	var src, dst netip.Addr
+	var proto, dscp uint8
+	var l4 []byte
+	if len(pkt) < 1 {
+		return fiveTuple{}, 0, false
+	}
+	switch pkt[0] >> 4 {
+	case 4:
+		ihl := int(pkt[0]&0x0f) * 4
+		if len(pkt) < 20 || ihl < 20 || len(pkt) < ihl {
+			return fiveTuple{}, 0, false
+		}
+		dscp = pkt[1] >> 2
+		proto = pkt[9]
+		src = netip.AddrFrom4([4]byte(pkt[12:16]))
+		dst = netip.AddrFrom4([4]byte(pkt[16:20]))
+		// ports are only available in the first fragment
+		if binary.BigEndian.Uint16(pkt[6:8])&0x1fff == 0 {
+			l4 = pkt[ihl:]
+		}
+	case 6:
+		if len(pkt) < 40 {
+			return fiveTuple{}, 0, false
+		}
+		dscp = (pkt[0]<<4 | pkt[1]>>4) >> 2
+		proto = pkt[6]
+		src = netip.AddrFrom16([16]byte(pkt[8:24]))
+		dst = netip.AddrFrom16([16]byte(pkt[24:40]))
+		l4 = pkt[40:]
+	default:
+		return fiveTuple{}, 0, false
+	}
+	var sport, dport uint16
+	switch proto {
+	case IP_PROTO_TCP, IP_PROTO_UDP, IP_PROTO_SCTP:
+		if len(l4) >= 4 {
+			sport = binary.BigEndian.Uint16(l4[0:2])
+			dport = binary.BigEndian.Uint16(l4[2:4])
+		}
+	}
+	if uplink {
+		return fiveTuple{local: src, remote: dst, protocol: proto, localPort: sport, remotePort: dport}, dscp, true
+	}
+	return fiveTuple{local: dst, remote: src, protocol: proto, localPort: dport, remotePort: sport}, dscp, true
+}
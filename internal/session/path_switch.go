@@ -0,0 +1,83 @@
+// Copyright Louis Royer and the NextMN contributors. All rights reserved.
+// Use of this source code is governed by a MIT-style license that can be
+// found in the LICENSE file.
+// SPDX-License-Identifier: MIT
+
+package session
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/nextmn/json-api/jsonapi"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+// Xn handover: once the UE has joined, the target gNB sends a Path Switch Request to the Control Plane,
+// with new DL FTEIDs
+func (s *PduSessions) sendPathSwitchRequest(ctx context.Context, ho targetHandover) error {
+	sessions := make([]Session, len(ho.Sessions))
+	for i, session := range ho.Sessions {
+		sessions[i] = session
+		sessions[i].ForwardDownlinkFteid = nil
+	}
+	req := PathSwitchRequest{
+		// Header
+		UeCtrl:    ho.UeCtrl,
+		Cp:        ho.Cp,
+		TargetgNB: ho.TargetgNB,
+		// Path Switch Request
+		SourcegNB: ho.SourcegNB,
+		Sessions:  sessions,
+	}
+	if err := s.Client.Post(ctx, s.Cp, "ps/path-switch-request", req); err != nil {
+		logrus.WithError(err).Error("Could not send ps/path-switch-request")
+		return err
+	}
+	return nil
+}
+
+func (s *PduSessions) PathSwitchRequestAck(c *gin.Context) {
+	var ps PathSwitchRequestAck
+	if err := c.BindJSON(&ps); err != nil {
+		logrus.WithError(err).Error("could not deserialize")
+		c.JSON(http.StatusBadRequest, jsonapi.MessageWithError{Message: "could not deserialize", Error: err})
+		return
+	}
+	logrus.WithFields(logrus.Fields{
+		"ue": ps.UeCtrl.String(),
+	}).Info("New Path Switch Request Ack")
+	s.StartProcedure(c, ps.UeCtrl, ProcPathSwitchRequestAck, func(ctx context.Context, _ UeState) (UeState, error) {
+		// the UE is connected, even if the source gNB cannot be notified
+		return UeStateConnected, s.HandlePathSwitchRequestAck(ctx, ps)
+	})
+}
+
+// Path Switch Request Ack is send to the target gNB by the Control Plane.
+// Upon receiving Path Switch Request Ack, the target gNB uses the new UL FTEIDs (if any),
+// and sends UE Context Release to the source gNB.
+func (s *PduSessions) HandlePathSwitchRequestAck(ctx context.Context, ps PathSwitchRequestAck) error {
+	for _, session := range ps.Sessions {
+		if err := s.manager.SwitchUplinkFteid(ps.UeCtrl, session); err != nil {
+			logrus.WithError(err).WithFields(logrus.Fields{
+				"ue":             ps.UeCtrl.String(),
+				"pdu-session-id": session.PduSessionId,
+			}).Error("Could not switch UL FTEID")
+		}
+	}
+	release := XnUeContextRelease{
+		// Header
+		UeCtrl:    ps.UeCtrl,
+		TargetgNB: ps.TargetgNB,
+		// UE Context Release
+		SourcegNB: ps.SourcegNB,
+		Sessions:  ps.Sessions,
+	}
+	if err := s.Client.Post(ctx, ps.SourcegNB, "xn/ue-context-release", release); err != nil {
+		logrus.WithError(err).Error("Could not send xn/ue-context-release")
+		return err
+	}
+	return nil
+}
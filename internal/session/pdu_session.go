@@ -0,0 +1,86 @@
+// Copyright Louis Royer and the NextMN contributors. All rights reserved.
+// Use of this source code is governed by a MIT-style license that can be
+// found in the LICENSE file.
+// SPDX-License-Identifier: MIT
+
+package session
+
+import (
+	"net/netip"
+	"sync"
+	"time"
+
+	"github.com/nextmn/json-api/jsonapi"
+	"github.com/nextmn/json-api/jsonapi/n1n2"
+)
+
+type PduSession struct {
+	UeCtrl               jsonapi.ControlURI `json:"ue-ctrl"`
+	UeAddr               netip.Addr         `json:"ue-addr"`
+	UeIpv6Prefix         *netip.Prefix      `json:"ue-ipv6-prefix,omitempty"`
+	PduSessionId         uint8              `json:"pdu-session-id,omitempty"`
+	PduSessionType       PduSessionType     `json:"pdu-session-type,omitempty"`
+	Dnn                  string             `json:"dnn,omitempty"`
+	Snssai               *Snssai            `json:"s-nssai,omitempty"`
+	QosFlows             []QosFlow          `json:"qos-flows,omitempty"`
+	QosRules             []QosRule          `json:"qos-rules,omitempty"` // sorted by precedence
+	DerivedQosRules      []QosRule          `json:"derived-qos-rules,omitempty"`
+	SessionAmbr          *BitRate           `json:"session-ambr,omitempty"`
+	DownlinkFteid        *jsonapi.Fteid     `json:"downlink-fteid"`
+	UplinkFteid          *jsonapi.Fteid     `json:"uplink-fteid,omitempty"`
+	ForwardDownlinkFteid *jsonapi.Fteid     `json:"forward-fteid,omitempty"`
+	CreatedAt            time.Time          `json:"created-at"`
+
+	// protects the fields below, and UplinkFteid (packet path state)
+	lock *sync.Mutex
+	ue   *UeContext
+
+	// qfi: number of packets
+	QosCounters   map[uint8]QosFlowCounters `json:"qos-counters,omitempty"`
+	PolicingDrops PolicingDrops             `json:"policing-drops"`
+
+	// target gNB during handover: DL packets from the direct path are held
+	// until forwarded DL traffic is finished (End Marker)
+	AwaitingEndMarker bool `json:"awaiting-end-marker,omitempty"`
+	forwardingSeen    bool
+	heldDownlink      [][]byte
+
+	// reflective QoS: UL rules derived from DL traffic
+	derivedQosRules map[fiveTuple]derivedQosRule
+
+	// policing
+	ulAmbr         *tokenBucket
+	dlAmbr         *tokenBucket
+	qosFlowBuckets map[uint8]flowBuckets
+}
+
+// Returns the (n1n2) Session describing this PDU Session
+func (s *PduSession) Session() Session {
+	return Session{
+		Session: n1n2.Session{
+			Addr:                 s.UeAddr,
+			Dnn:                  s.Dnn,
+			UplinkFteid:          s.UplinkFteid,
+			DownlinkFteid:        s.DownlinkFteid,
+			ForwardDownlinkFteid: s.ForwardDownlinkFteid,
+		},
+		Ipv6Prefix:     s.UeIpv6Prefix,
+		PduSessionId:   s.PduSessionId,
+		PduSessionType: s.PduSessionType,
+		Snssai:         s.Snssai,
+		QosFlows:       s.QosFlows,
+		QosRules:       s.QosRules,
+		SessionAmbr:    s.SessionAmbr,
+	}
+}
+
+// Returns true if the address belongs to the UE for this PDU Session
+func (s *PduSession) HasAddr(addr netip.Addr) bool {
+	if s.UeAddr.IsValid() && s.UeAddr == addr {
+		return true
+	}
+	if s.UeIpv6Prefix != nil && s.UeIpv6Prefix.Contains(addr) {
+		return true
+	}
+	return false
+}
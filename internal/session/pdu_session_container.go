@@ -0,0 +1,95 @@
+// Copyright Louis Royer and the NextMN contributors. All rights reserved.
+// Use of this source code is governed by a MIT-style license that can be
+// found in the LICENSE file.
+// SPDX-License-Identifier: MIT
+
+package session
+
+import (
+	"github.com/wmnsk/go-gtp/gtpv1/message"
+)
+
+// PDU Session Container (TS 38.415), carried in a GTP-U extension header on N3.
+//
+// DL PDU SESSION INFORMATION:
+//
+//	 0                   1                   2
+//	 0 1 2 3 4 5 6 7 8 9 0 1 2 3 4 5 6 7 8 9 0 1 2 3
+//	+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+//	|PDU Type=0 |Q|S|M|P|R|    QFI    | PPI | (PPP=1)
+//	+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+//
+// UL PDU SESSION INFORMATION:
+//
+//	 0                   1
+//	 0 1 2 3 4 5 6 7 8 9 0 1 2 3 4 5
+//	+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+//	|PDU Type=1 | flags |   |  QFI  |
+//	+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+const (
+	PDU_SESSION_CONTAINER_DL = 0 // DL PDU SESSION INFORMATION
+	PDU_SESSION_CONTAINER_UL = 1 // UL PDU SESSION INFORMATION
+	MAX_QFI                  = 63
+)
+
+type PduSessionContainer struct {
+	PduType uint8 // PDU_SESSION_CONTAINER_DL or PDU_SESSION_CONTAINER_UL
+	Qfi     uint8 // QoS Flow Identifier
+	Rqi     bool  // Reflective QoS Indicator (DL only)
+	Ppp     bool  // Paging Policy Presence (DL only)
+	Ppi     uint8 // Paging Policy Indicator (DL only, when Ppp is set)
+}
+
+// Creates an UL PDU SESSION INFORMATION container
+func NewUlPduSessionContainer(qfi uint8) PduSessionContainer {
+	return PduSessionContainer{
+		PduType: PDU_SESSION_CONTAINER_UL,
+		Qfi:     qfi & MAX_QFI,
+	}
+}
+
+// Returns the GTP-U extension header carrying the container
+func (c PduSessionContainer) ExtensionHeader() *message.ExtensionHeader {
+	content := []byte{c.PduType << 4, c.Qfi & MAX_QFI}
+	if c.PduType == PDU_SESSION_CONTAINER_DL {
+		if c.Rqi {
+			content[1] |= 0x40
+		}
+		if c.Ppp {
+			content[1] |= 0x80
+			content = append(content, (c.Ppi&0x07)<<5)
+		}
+	}
+	return message.NewExtensionHeader(message.ExtHeaderTypePDUSessionContainer, content, message.ExtHeaderTypeNoMoreExtensionHeaders)
+}
+
+// Returns the PDU Session Container of a G-PDU
+func ParsePduSessionContainer(hdr *message.Header) (PduSessionContainer, error) {
+	if hdr == nil || !hdr.HasExtensionHeader() {
+		return PduSessionContainer{}, ErrNoPduSessionContainer
+	}
+	for _, eh := range hdr.ExtensionHeaders {
+		if eh.Type != message.ExtHeaderTypePDUSessionContainer {
+			continue
+		}
+		if len(eh.Content) < 2 {
+			return PduSessionContainer{}, ErrMalformedPduSessionContainer
+		}
+		c := PduSessionContainer{
+			PduType: eh.Content[0] >> 4,
+			Qfi:     eh.Content[1] & MAX_QFI,
+		}
+		if c.PduType == PDU_SESSION_CONTAINER_DL {
+			c.Rqi = eh.Content[1]&0x40 != 0
+			c.Ppp = eh.Content[1]&0x80 != 0
+			if c.Ppp {
+				if len(eh.Content) < 3 {
+					return PduSessionContainer{}, ErrMalformedPduSessionContainer
+				}
+				c.Ppi = eh.Content[2] >> 5
+			}
+		}
+		return c, nil
+	}
+	return PduSessionContainer{}, ErrNoPduSessionContainer
+}
@@ -6,9 +6,9 @@
 package session
 
 import (
-	"net/http"
 	"net/netip"
 	"sync"
+	"time"
 
 	"github.com/nextmn/gnb-lite/internal/common"
 
@@ -17,29 +17,57 @@ import (
 	"github.com/gin-gonic/gin"
 )
 
+// Maximum duration of the messages sent by a procedure, retries included
+const DEFAULT_PROCEDURE_TIMEOUT = 30 * time.Second
+
 type PduSessions struct {
 	common.WithContext
 
-	PduSessionsMap sync.Map // key : UE 5G ip address; value: UE Control URI
-	UserAgent      string
-	Client         http.Client
-	Control        jsonapi.ControlURI
-	Cp             jsonapi.ControlURI
-	GnbGtp         netip.Addr
-	manager        *PduSessionsManager
+	Client  *common.Client
+	Control jsonapi.ControlURI
+	Cp      jsonapi.ControlURI
+	GnbGtp  netip.Addr
+	manager *PduSessionsManager
+
+	// target gNB: handovers waiting for the Handover Confirm of the UE
+	hoLock    sync.Mutex
+	handovers map[string]targetHandover // ue control uri: prepared handover
+
+	ueLock   sync.Mutex
+	ueStates map[string]*ueStateMachine // ue control uri: state machine
+
+	procedures       *common.Procedures
+	procedureTimeout time.Duration
 }
 
-func NewPduSessions(control jsonapi.ControlURI, cp jsonapi.ControlURI, manager *PduSessionsManager, userAgent string, gnbGtp netip.Addr) *PduSessions {
-	return &PduSessions{
-		Client:         http.Client{},
-		PduSessionsMap: sync.Map{},
-		UserAgent:      userAgent,
-		Control:        control,
-		Cp:             cp,
-		GnbGtp:         gnbGtp,
-		manager:        manager,
+func NewPduSessions(control jsonapi.ControlURI, cp jsonapi.ControlURI, manager *PduSessionsManager, client *common.Client, gnbGtp netip.Addr, procedures *common.Procedures, procedureTimeout time.Duration) *PduSessions {
+	if procedureTimeout <= 0 {
+		procedureTimeout = DEFAULT_PROCEDURE_TIMEOUT
 	}
+	s := &PduSessions{
+		Client:           client,
+		Control:          control,
+		Cp:               cp,
+		GnbGtp:           gnbGtp,
+		manager:          manager,
+		handovers:        make(map[string]targetHandover),
+		ueStates:         make(map[string]*ueStateMachine),
+		procedures:       procedures,
+		procedureTimeout: procedureTimeout,
+	}
+	manager.OnUeContextRemoved(s.ueContextRemoved)
+	return s
+
+}
 
+// Returns every PDU Session of the UE
+func (p *PduSessions) UeSessions(ue jsonapi.ControlURI) []Session {
+	pduSessions := p.manager.UePduSessions(ue)
+	sessions := make([]Session, len(pduSessions))
+	for i, pduSession := range pduSessions {
+		sessions[i] = pduSession.Session()
+	}
+	return sessions
 }
 
 func (p *PduSessions) Register(e *gin.Engine) {
@@ -48,4 +76,19 @@ func (p *PduSessions) Register(e *gin.Engine) {
 	e.POST("/ps/handover-request", p.HandoverRequest)
 	e.POST("/ps/handover-command", p.HandoverCommand)
 	e.POST("/ps/handover-confirm", p.HandoverConfirm)
+	e.POST("/ps/handover-cancel", p.HandoverCancel)
+	e.POST("/ps/handover-cancel-ack", p.HandoverCancelAck)
+	e.POST("/ps/handover-preparation-failure", p.HandoverPreparationFailure)
+	e.POST("/ps/path-switch-request-ack", p.PathSwitchRequestAck)
+	e.POST("/ps/release-request", p.ReleaseRequest)
+	e.POST("/ps/release-command", p.ReleaseCommand)
+	e.POST("/xn/handover-request", p.XnHandoverRequest)
+	e.POST("/xn/handover-request-ack", p.XnHandoverRequestAck)
+	e.POST("/xn/sn-status-transfer", p.XnSnStatusTransfer)
+	e.POST("/xn/ue-context-release", p.XnUeContextRelease)
+	e.POST("/xn/handover-cancel", p.HandoverCancel)
+	e.POST("/xn/handover-preparation-failure", p.HandoverPreparationFailure)
+	e.GET("/ues", p.UeStates)
+	e.GET("/ps", p.List)
+	e.GET("/ps/:teid", p.Get)
 }
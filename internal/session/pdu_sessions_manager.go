@@ -6,130 +6,145 @@
 package session
 
 import (
+	"cmp"
 	"context"
+	"maps"
 	"math/rand"
-	"net"
 	"net/netip"
+	"slices"
 	"sync"
 	"time"
 
+	"github.com/nextmn/gnb-lite/internal/common"
+	"github.com/nextmn/gnb-lite/internal/metrics"
+
 	"github.com/nextmn/json-api/jsonapi"
 
 	"github.com/sirupsen/logrus"
-	"github.com/wmnsk/go-gtp/gtpv1"
 	"github.com/wmnsk/go-gtp/gtpv1/message"
 )
 
-const GTPU_PORT = 2152
+const (
+	GTPU_PORT                  = 2152
+	DEFAULT_FORWARDING_TIMEOUT = 10 * time.Second
+)
 
 type PduSessionsManager struct {
-	sync.Mutex
+	sync.Mutex // serialises control updates
 
-	Downlink        map[uint32]jsonapi.ControlURI // teid: UE control uri
-	ForwardDownlink map[uint32]*jsonapi.Fteid
-	Uplink          map[netip.Addr]*jsonapi.Fteid // ue 5G ip address: uplink fteid
-	GtpAddr         netip.Addr
-	upfs            map[netip.Addr]*gtpv1.UPlaneConn
-}
+	// tables modified by control updates (see sessionTables)
+	ues             map[string]*UeContext  // ue control uri: UE Context
+	downlink        map[uint32]*PduSession // teid: PDU Session
+	forwardDownlink map[uint32]*jsonapi.Fteid
+	uplink          map[netip.Addr]*PduSession   // ue 5G ipv4 address: IP PDU Session
+	uplinkV6        map[netip.Prefix]*PduSession // ue 5G ipv6 prefix (/64): IP PDU Session
 
-func NewPduSessionsManager(gtpAddr netip.Addr) *PduSessionsManager {
-	return &PduSessionsManager{
-		Downlink:        make(map[uint32]jsonapi.ControlURI),
-		ForwardDownlink: make(map[uint32]*jsonapi.Fteid),
-		Uplink:          make(map[netip.Addr]*jsonapi.Fteid),
-		GtpAddr:         gtpAddr,
-		upfs:            make(map[netip.Addr]*gtpv1.UPlaneConn),
-	}
+	tables    sessionTables // tables used on the packet path
+	uplinkMac sync.Map      // ue source mac address (macAddr): Ethernet PDU Session (learned on the packet path)
+
+	n3        []N3Address
+	n3Writers map[netip.Addr]N3Writer // n3 address: sockets bound to this address
+	n3Buffers *common.BufferPool
+
+	forwardingTimeout  time.Duration
+	reflectiveQosTimer time.Duration
+	defaultUeAmbr      *BitRate
+	defaultSessionAmbr *BitRate
+	forwardingTimers   *Timers // teid: removal of ForwardDownlink and source PDU Session
+	endMarkerTimers    *Timers // teid: end of forwarded DL traffic on target PDU Session
+	downlinkWriter     DownlinkWriter
+	ueContextRemoved   []func(ue jsonapi.ControlURI)
 }
 
-func (p *PduSessionsManager) ForwardUplink(ctx context.Context, pkt []byte, fteid *jsonapi.Fteid) error {
-	gpdu := message.NewHeaderWithExtensionHeaders(0x30, message.MsgTypeTPDU, fteid.Teid, 0, pkt, []*message.ExtensionHeader{}...)
-	b, err := gpdu.Marshal()
-	if err != nil {
-		return err
+// DL FTEIDs are allocated on the N3 addresses (at least one)
+func NewPduSessionsManager(n3 []N3Address, forwardingTimeout time.Duration, reflectiveQosTimer time.Duration) *PduSessionsManager {
+	if forwardingTimeout <= 0 {
+		forwardingTimeout = DEFAULT_FORWARDING_TIMEOUT
 	}
-	raddr := net.UDPAddrFromAddrPort(netip.AddrPortFrom(fteid.Addr, GTPU_PORT))
-	uConn, ok := p.upfs[fteid.Addr]
-	if !ok {
-		laddr := net.UDPAddrFromAddrPort(netip.AddrPortFrom(p.GtpAddr, 0))
-		uConn, err = gtpv1.DialUPlane(ctx, laddr, raddr)
-		if err != nil {
-			logrus.WithFields(logrus.Fields{
-				"upf": raddr,
-			}).Error("Failure to dial UPF")
-			return err
-		}
-		p.upfs[fteid.Addr] = uConn
-		go func(ctx context.Context, uConn *gtpv1.UPlaneConn) error {
-			<-ctx.Done()
-			uConn.Close()
-			return ctx.Err()
-		}(ctx, uConn)
+	if reflectiveQosTimer <= 0 {
+		reflectiveQosTimer = DEFAULT_REFLECTIVE_QOS_TIMER
+	}
+	p := &PduSessionsManager{
+		ues:                make(map[string]*UeContext),
+		downlink:           make(map[uint32]*PduSession),
+		forwardDownlink:    make(map[uint32]*jsonapi.Fteid),
+		uplink:             make(map[netip.Addr]*PduSession),
+		uplinkV6:           make(map[netip.Prefix]*PduSession),
+		n3:                 n3,
+		n3Writers:          make(map[netip.Addr]N3Writer, len(n3)),
+		n3Buffers:          common.NewBufferPool(common.TX_BUFFER_SIZE),
+		forwardingTimeout:  forwardingTimeout,
+		reflectiveQosTimer: reflectiveQosTimer,
+		forwardingTimers:   NewTimers(),
+		endMarkerTimers:    NewTimers(),
 	}
+	p.tables.init()
+	return p
+}
+
+// Adds a function called when every PDU Session of a UE has been removed
+func (p *PduSessionsManager) OnUeContextRemoved(f func(ue jsonapi.ControlURI)) {
+	p.Lock()
+	defer p.Unlock()
+	p.ueContextRemoved = append(p.ueContextRemoved, f)
+}
+
+// Set the writer used to send to the UE DL packets that have been held
+func (p *PduSessionsManager) SetDownlinkWriter(w DownlinkWriter) {
+	p.Lock()
+	defer p.Unlock()
+	p.downlinkWriter = w
+}
+
+// Sends a G-PDU to the GTP-U peer from the N3 address src, with the optional extension headers
+func (p *PduSessionsManager) ForwardUplink(ctx context.Context, src netip.Addr, pkt []byte, fteid *jsonapi.Fteid, extHdrs ...*message.ExtensionHeader) error {
 	logrus.WithFields(logrus.Fields{
 		"fteid": fteid,
 	}).Trace("Forwarding packet to GTP")
-	_, err = uConn.WriteTo(b, raddr)
-	return err
+	return p.writeN3(src, fteid, message.NewHeaderWithExtensionHeaders(0x30, message.MsgTypeTPDU, fteid.Teid, 0, pkt, extHdrs...))
 }
 
 func (p *PduSessionsManager) WriteUplink(ctx context.Context, pkt []byte) error {
-	if len(pkt) < 20 {
-		logrus.Trace("too small to be an ipv4 packet")
-		return ErrUnsupportedPDUType
+	src, err := uplinkSource(pkt)
+	if err != nil {
+		return err
 	}
-	if (pkt[0] >> 4) != 4 {
-		logrus.Trace("not an ipv4 packet")
-		return ErrUnsupportedPDUType
+	session, ok := p.tables.uplinkSession(src)
+	if ok {
+		session.lock.Lock()
 	}
-	src := netip.AddrFrom4([4]byte{pkt[12], pkt[13], pkt[14], pkt[15]})
-	fteid, ok := p.Uplink[src]
-	if !ok {
+	if !ok || session.UplinkFteid == nil {
+		if ok {
+			session.lock.Unlock()
+		}
 		logrus.WithFields(logrus.Fields{
 			"ue": src,
 		}).Trace("unknown UE")
 		return ErrPduSessionNotFound
 	}
-	gpdu := message.NewHeaderWithExtensionHeaders(0x30, message.MsgTypeTPDU, fteid.Teid, 0, pkt, []*message.ExtensionHeader{}...)
-	b, err := gpdu.Marshal()
+	fteid := session.UplinkFteid
+	extHdrs, err := p.uplinkContainer(session, 0, pkt)
+	session.lock.Unlock()
 	if err != nil {
 		return err
 	}
-	raddr := net.UDPAddrFromAddrPort(netip.AddrPortFrom(fteid.Addr, GTPU_PORT))
-	uConn, ok := p.upfs[fteid.Addr]
-	if !ok {
-		laddr := net.UDPAddrFromAddrPort(netip.AddrPortFrom(p.GtpAddr, 0))
-		uConn, err = gtpv1.DialUPlane(ctx, laddr, raddr)
-		if err != nil {
-			logrus.WithFields(logrus.Fields{
-				"upf": raddr,
-			}).Error("Failure to dial UPF")
-			return err
-		}
-		p.upfs[fteid.Addr] = uConn
-		go func(ctx context.Context, uConn *gtpv1.UPlaneConn) error {
-			<-ctx.Done()
-			uConn.Close()
-			return ctx.Err()
-		}(ctx, uConn)
+	if err := p.ForwardUplink(ctx, session.DownlinkFteid.Addr, pkt, fteid, extHdrs...); err != nil {
+		return err
 	}
-	logrus.WithFields(logrus.Fields{
-		"fteid": fteid,
-	}).Trace("Forwarding packet to GTP")
-	_, err = uConn.WriteTo(b, raddr)
-	return err
+	metrics.Packet(metrics.PathN3Uplink, len(pkt))
+	return nil
 }
 
 func (p *PduSessionsManager) GetUECtrl(teid uint32) (jsonapi.ControlURI, error) {
-	ueCtrl, ok := p.Downlink[teid]
+	session, ok := p.tables.downlink.Load(teid)
 	if !ok {
-		return ueCtrl, ErrPduSessionNotFound
+		return jsonapi.ControlURI{}, ErrPduSessionNotFound
 	}
-	return ueCtrl, nil
+	return session.UeCtrl, nil
 }
 
 func (p *PduSessionsManager) GetForwarding(teid uint32) (*jsonapi.Fteid, error) {
-	fteid, ok := p.ForwardDownlink[teid]
+	fteid, ok := p.tables.forwardDownlink.Load(teid)
 	if !ok {
 		return fteid, ErrForwardDownlinkNotFound
 	}
@@ -141,37 +156,459 @@ type Fteid struct {
 	Teid   uint32
 }
 
-// Returns the new DL TEID allocated
-func (p *PduSessionsManager) NewPduSession(ctx context.Context, ueIpAddr netip.Addr, ueControlURI jsonapi.ControlURI, uplinkFteid *jsonapi.Fteid) (*jsonapi.Fteid, error) {
+// Returns the source address of an uplink IPv4 or IPv6 packet
+func uplinkSource(pkt []byte) (netip.Addr, error) {
+	if len(pkt) < 1 {
+		logrus.Trace("empty packet")
+		return netip.Addr{}, ErrUnsupportedPDUType
+	}
+	switch pkt[0] >> 4 {
+	case 4:
+		if len(pkt) < 20 {
+			logrus.Trace("too small to be an ipv4 packet")
+			return netip.Addr{}, ErrUnsupportedPDUType
+		}
+		return netip.AddrFrom4([4]byte(pkt[12:16])), nil
+	case 6:
+		if len(pkt) < 40 {
+			logrus.Trace("too small to be an ipv6 packet")
+			return netip.Addr{}, ErrUnsupportedPDUType
+		}
+		return netip.AddrFrom16([16]byte(pkt[8:24])), nil
+	default:
+		logrus.Trace("not an ip packet")
+		return netip.Addr{}, ErrUnsupportedPDUType
+	}
+}
+
+// IPv6 PDU Sessions are identified by their /64 prefix
+func ipv6Prefix(addr netip.Addr) netip.Prefix {
+	return netip.PrefixFrom(addr, 64).Masked()
+}
+
+// Creates a new PDU Session in the UE Context, and returns a copy of it (including the new DL FTEID allocated).
+// When s.PduSessionId is not provided, a new PDU Session ID is allocated for the UE;
+// otherwise, a previous PDU Session of the UE with the same ID is replaced.
+// For IP PDU Sessions, s.Addr is the IPv4 or IPv6 address of the UE, and s.Ipv6Prefix is the IPv6 prefix of IPv4v6 PDU Sessions.
+// Uplink traffic can also be sent in radio frames identifying the PDU Session (required for non-IP PDU Sessions).
+func (p *PduSessionsManager) NewPduSession(ctx context.Context, ueControlURI jsonapi.ControlURI, s Session) (PduSession, error) {
 	p.Lock()
 	defer p.Unlock()
 
+	ue, ok := p.ues[ueControlURI.String()]
+	if !ok {
+		ue = NewUeContext(ueControlURI)
+		ue.setAmbr(p.defaultUeAmbr)
+	}
+	psi := s.PduSessionId
+	if psi == 0 {
+		var err error
+		psi, err = ue.newPduSessionId()
+		if err != nil {
+			return PduSession{}, err
+		}
+	} else if psi > MAX_PDU_SESSION_ID {
+		return PduSession{}, ErrInvalidPduSessionId
+	}
+
 	ctxTimeout, cancel := context.WithTimeout(ctx, time.Duration(time.Millisecond*10)) // 10 ms should be more than enough…
 	defer cancel()
-	dlTeid, err := p.newTeidDl(ctxTimeout, ueControlURI)
+	session := &PduSession{
+		UeCtrl:         ueControlURI,
+		UeAddr:         s.Addr,
+		UplinkFteid:    s.UplinkFteid,
+		PduSessionId:   psi,
+		PduSessionType: s.PduSessionType,
+		Dnn:            s.Dnn,
+		Snssai:         s.Snssai,
+		QosFlows:       s.QosFlows,
+		QosRules:       slices.Clone(s.QosRules),
+		CreatedAt:      time.Now(),
+		lock:           &sync.Mutex{},
+		ue:             ue,
+	}
+	slices.SortStableFunc(session.QosRules, func(a, b QosRule) int {
+		return cmp.Compare(a.Precedence, b.Precedence)
+	})
+	session.SessionAmbr = s.SessionAmbr
+	if session.SessionAmbr == nil {
+		session.SessionAmbr = p.defaultSessionAmbr
+	}
+	session.ulAmbr, session.dlAmbr = newTokenBuckets(session.SessionAmbr)
+	session.qosFlowBuckets = make(map[uint8]flowBuckets, len(s.QosFlows))
+	for _, flow := range s.QosFlows {
+		ul, dl := newTokenBuckets(flow.Mfbr)
+		session.qosFlowBuckets[flow.Qfi] = flowBuckets{ul: ul, dl: dl, gbr: flow.Gfbr != nil}
+	}
+	if s.PduSessionType.IsIP() {
+		if s.Ipv6Prefix != nil {
+			prefix := ipv6Prefix(s.Ipv6Prefix.Addr())
+			session.UeIpv6Prefix = &prefix
+		} else if s.Addr.Is6() {
+			prefix := ipv6Prefix(s.Addr)
+			session.UeIpv6Prefix = &prefix
+		}
+	}
+	var upf netip.Addr
+	if s.UplinkFteid != nil {
+		upf = s.UplinkFteid.Addr
+	}
+	n3Addr, err := p.selectN3Addr(upf, s.Dnn, s.Snssai)
+	if err != nil {
+		return PduSession{}, err
+	}
+	dlTeid, err := p.newTeidDl(ctxTimeout, session)
 	if err != nil {
-		return nil, err
+		return PduSession{}, err
+	}
+	session.DownlinkFteid = jsonapi.NewFteid(n3Addr, dlTeid)
+	if s.PduSessionType.IsIP() && s.Addr.Is4() {
+		p.uplink[s.Addr] = session
+	}
+	if session.UeIpv6Prefix != nil {
+		p.uplinkV6[*session.UeIpv6Prefix] = session
+	}
+	old, replaced := ue.Sessions[psi]
+	ue.Sessions[psi] = session
+	p.ues[ueControlURI.String()] = ue
+	// the PDU Session is initialised: it can be used on the packet path
+	p.tables.downlink.Store(dlTeid, session)
+	if s.PduSessionType.IsIP() && s.Addr.Is4() {
+		p.tables.uplink.Store(s.Addr, session)
+	}
+	if session.UeIpv6Prefix != nil {
+		p.tables.uplinkV6.Store(*session.UeIpv6Prefix, session)
+	}
+	p.tables.ueSessions.Store(ueSessionKey{ue: ueControlURI.String(), psi: psi}, session)
+	metrics.SetActivePduSessions(len(p.downlink))
+	if replaced {
+		// removed once the new PDU Session is installed, so the UE context is kept
+		logrus.WithFields(logrus.Fields{
+			"ue":             ueControlURI.String(),
+			"pdu-session-id": psi,
+		}).Info("Replacing previous PDU Session with the same ID")
+		p.removePduSession(old.DownlinkFteid.Teid)
+	}
+	return p.pduSession(dlTeid), nil
+}
+
+// Warning: not thread safe
+func (p *PduSessionsManager) removePduSession(dlTeid uint32) {
+	p.forwardingTimers.Stop(dlTeid)
+	p.endMarkerTimers.Stop(dlTeid)
+	delete(p.forwardDownlink, dlTeid)
+	p.tables.forwardDownlink.Delete(dlTeid)
+	session, ok := p.downlink[dlTeid]
+	if !ok {
+		return
+	}
+	delete(p.downlink, dlTeid)
+	p.tables.downlink.Delete(dlTeid)
+	metrics.SetActivePduSessions(len(p.downlink))
+	// uplink may already be used by a newer PDU Session of the UE
+	if p.uplink[session.UeAddr] == session {
+		delete(p.uplink, session.UeAddr)
+		p.tables.uplink.Delete(session.UeAddr)
+	}
+	if session.UeIpv6Prefix != nil && p.uplinkV6[*session.UeIpv6Prefix] == session {
+		delete(p.uplinkV6, *session.UeIpv6Prefix)
+		p.tables.uplinkV6.Delete(*session.UeIpv6Prefix)
+	}
+	if ue, ok := p.ues[session.UeCtrl.String()]; ok && ue.Sessions[session.PduSessionId] == session {
+		delete(ue.Sessions, session.PduSessionId)
+		p.tables.ueSessions.Delete(ueSessionKey{ue: session.UeCtrl.String(), psi: session.PduSessionId})
+		if len(ue.Sessions) == 0 {
+			delete(p.ues, session.UeCtrl.String())
+			for _, f := range p.ueContextRemoved {
+				go f(session.UeCtrl)
+			}
+		}
+	}
+	for mac, s := range p.uplinkMac.Range {
+		if s == session {
+			p.uplinkMac.CompareAndDelete(mac, s)
+		}
+	}
+}
+
+// Returns true if the UE has at least one PDU Session
+func (p *PduSessionsManager) HasUeContext(ueControlURI jsonapi.ControlURI) bool {
+	p.Lock()
+	defer p.Unlock()
+	_, ok := p.ues[ueControlURI.String()]
+	return ok
+}
+
+// Returns a copy of every PDU Session of the UE
+func (p *PduSessionsManager) UePduSessions(ueControlURI jsonapi.ControlURI) []PduSession {
+	p.Lock()
+	defer p.Unlock()
+
+	ue, ok := p.ues[ueControlURI.String()]
+	if !ok {
+		return []PduSession{}
 	}
-	p.Uplink[ueIpAddr] = uplinkFteid
-	return jsonapi.NewFteid(p.GtpAddr, dlTeid), err
+	sessions := make([]PduSession, 0, len(ue.Sessions))
+	for _, session := range ue.Sessions {
+		sessions = append(sessions, p.pduSession(session.DownlinkFteid.Teid))
+	}
+	return sessions
 }
 
 // Warning: not thread safe
-func (p *PduSessionsManager) newTeidDl(ctx context.Context, ueControlURI jsonapi.ControlURI) (uint32, error) {
+func (p *PduSessionsManager) lookupPduSession(ueControlURI jsonapi.ControlURI, s Session) (*PduSession, error) {
+	ue, ok := p.ues[ueControlURI.String()]
+	if !ok {
+		return nil, ErrPduSessionNotFound
+	}
+	session, ok := ue.lookup(s)
+	if !ok {
+		return nil, ErrPduSessionNotFound
+	}
+	return session, nil
+}
+
+// Removes the PDU Session of the UE described by s, and returns a copy of it
+func (p *PduSessionsManager) ReleasePduSession(ueControlURI jsonapi.ControlURI, s Session) (PduSession, error) {
+	p.Lock()
+	defer p.Unlock()
+
+	session, err := p.lookupPduSession(ueControlURI, s)
+	if err != nil {
+		return PduSession{}, err
+	}
+	released := p.pduSession(session.DownlinkFteid.Teid)
+	p.removePduSession(session.DownlinkFteid.Teid)
+	return released, nil
+}
+
+// Removes every PDU Session using this uplink FTEID, and returns them
+func (p *PduSessionsManager) ReleaseUplinkFteid(uplinkFteid jsonapi.Fteid) ([]PduSession, error) {
+	p.Lock()
+	defer p.Unlock()
+
+	released := []PduSession{}
+	for dlTeid, session := range p.downlink {
+		session.lock.Lock()
+		uses := session.UplinkFteid != nil && *session.UplinkFteid == uplinkFteid
+		session.lock.Unlock()
+		if !uses {
+			continue
+		}
+		released = append(released, p.pduSession(dlTeid))
+		p.removePduSession(dlTeid)
+	}
+	if len(released) == 0 {
+		return nil, ErrPduSessionNotFound
+	}
+	return released, nil
+}
+
+// Configures forwarding of DL traffic of the PDU Session of the UE described by s (source gNB during handover).
+// Forwarding and the source PDU Session are removed when the forwarding timer expires
+// or when an End Marker is received.
+func (p *PduSessionsManager) StartForwarding(ueControlURI jsonapi.ControlURI, s Session, forwardFteid *jsonapi.Fteid) error {
+	p.Lock()
+	defer p.Unlock()
+	session, err := p.lookupPduSession(ueControlURI, s)
+	if err != nil {
+		return err
+	}
+	dlTeid := session.DownlinkFteid.Teid
+	p.forwardDownlink[dlTeid] = forwardFteid
+	p.tables.forwardDownlink.Store(dlTeid, forwardFteid)
+	p.forwardingTimers.Start(dlTeid, p.forwardingTimeout, func() {
+		logrus.WithFields(logrus.Fields{
+			"dl-teid": dlTeid,
+		}).Info("Forwarding timer expired: removing source PDU Session")
+		p.removeSourcePduSession(dlTeid)
+	})
+	return nil
+}
+
+// Source gNB (Xn handover): removes every PDU Session of the UE, except those still forwarding DL traffic
+// (they are removed when the forwarding timer expires or when an End Marker is received)
+func (p *PduSessionsManager) ReleaseSourcePduSessions(ueControlURI jsonapi.ControlURI) []PduSession {
+	p.Lock()
+	defer p.Unlock()
+
+	released := []PduSession{}
+	ue, ok := p.ues[ueControlURI.String()]
+	if !ok {
+		return released
+	}
+	for _, session := range ue.Sessions {
+		dlTeid := session.DownlinkFteid.Teid
+		if _, forwarding := p.forwardDownlink[dlTeid]; forwarding {
+			continue
+		}
+		released = append(released, p.pduSession(dlTeid))
+		p.removePduSession(dlTeid)
+	}
+	return released
+}
+
+// Target gNB (path switch): replaces the UL FTEID of the PDU Session of the UE described by s,
+// when a new UL FTEID is provided
+func (p *PduSessionsManager) SwitchUplinkFteid(ueControlURI jsonapi.ControlURI, s Session) error {
+	p.Lock()
+	defer p.Unlock()
+	session, err := p.lookupPduSession(ueControlURI, s)
+	if err != nil {
+		return err
+	}
+	if s.UplinkFteid != nil {
+		session.lock.Lock()
+		session.UplinkFteid = s.UplinkFteid
+		session.lock.Unlock()
+	}
+	return nil
+}
+
+// Returns the SN Status of every PDU Session of the UE (source gNB during Xn handover)
+func (p *PduSessionsManager) SnStatus(ueControlURI jsonapi.ControlURI) []SnStatus {
+	p.Lock()
+	defer p.Unlock()
+	ue, ok := p.ues[ueControlURI.String()]
+	if !ok {
+		return []SnStatus{}
+	}
+	res := make([]SnStatus, 0, len(ue.Sessions))
+	for psi, session := range ue.Sessions {
+		status := SnStatus{PduSessionId: psi}
+		session.lock.Lock()
+		for _, counters := range session.QosCounters {
+			status.UlCount += counters.UplinkPackets
+			status.DlCount += counters.DownlinkPackets
+		}
+		session.lock.Unlock()
+		res = append(res, status)
+	}
+	return res
+}
+
+// Source gNB (cancelled handover): stops forwarding DL traffic of the PDU Session of the UE described by s.
+// The PDU Session is kept.
+func (p *PduSessionsManager) StopForwarding(ueControlURI jsonapi.ControlURI, s Session) error {
+	p.Lock()
+	defer p.Unlock()
+	session, err := p.lookupPduSession(ueControlURI, s)
+	if err != nil {
+		return err
+	}
+	dlTeid := session.DownlinkFteid.Teid
+	p.forwardingTimers.Stop(dlTeid)
+	if _, ok := p.forwardDownlink[dlTeid]; !ok {
+		return ErrForwardDownlinkNotFound
+	}
+	delete(p.forwardDownlink, dlTeid)
+	p.tables.forwardDownlink.Delete(dlTeid)
+	return nil
+}
+
+// Target gNB (failed or cancelled handover): removes PDU Sessions of the UE
+// using the DL FTEIDs of sessions, and returns them
+func (p *PduSessionsManager) RollbackPduSessions(ueControlURI jsonapi.ControlURI, sessions []Session) []PduSession {
+	p.Lock()
+	defer p.Unlock()
+
+	released := []PduSession{}
+	for _, s := range sessions {
+		if s.DownlinkFteid == nil {
+			continue
+		}
+		session, ok := p.downlink[s.DownlinkFteid.Teid]
+		if !ok || session.UeCtrl.String() != ueControlURI.String() {
+			continue
+		}
+		released = append(released, p.pduSession(s.DownlinkFteid.Teid))
+		p.removePduSession(s.DownlinkFteid.Teid)
+	}
+	return released
+}
+
+func (p *PduSessionsManager) removeSourcePduSession(dlTeid uint32) {
+	p.Lock()
+	defer p.Unlock()
+	p.removePduSession(dlTeid)
+}
+
+// Returns a copy of every PDU Session
+func (p *PduSessionsManager) PduSessions() []PduSession {
+	p.Lock()
+	defer p.Unlock()
+
+	sessions := make([]PduSession, 0, len(p.downlink))
+	for teid := range p.downlink {
+		sessions = append(sessions, p.pduSession(teid))
+	}
+	return sessions
+}
+
+// Returns a copy of the PDU Session identified by its DL TEID
+func (p *PduSessionsManager) PduSession(dlTeid uint32) (PduSession, error) {
+	p.Lock()
+	defer p.Unlock()
+
+	if _, ok := p.downlink[dlTeid]; !ok {
+		return PduSession{}, ErrPduSessionNotFound
+	}
+	return p.pduSession(dlTeid), nil
+}
+
+// Returns the address of every GTP-U peer (UPFs, and gNBs used for indirect forwarding)
+func (p *PduSessionsManager) GtpPeers() []netip.Addr {
+	p.Lock()
+	defer p.Unlock()
+
+	peers := make(map[netip.Addr]struct{})
+	for _, session := range p.downlink {
+		session.lock.Lock()
+		if session.UplinkFteid != nil {
+			peers[session.UplinkFteid.Addr] = struct{}{}
+		}
+		session.lock.Unlock()
+	}
+	for _, fteid := range p.forwardDownlink {
+		peers[fteid.Addr] = struct{}{}
+	}
+	res := make([]netip.Addr, 0, len(peers))
+	for peer := range peers {
+		res = append(res, peer)
+	}
+	return res
+}
+
+// Warning: not thread safe
+func (p *PduSessionsManager) pduSession(dlTeid uint32) PduSession {
+	s := p.downlink[dlTeid]
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	session := *s
+	session.QosCounters = maps.Clone(session.QosCounters)
+	session.heldDownlink = nil
+	session.DerivedQosRules = session.derivedQosRulesList()
+	if fteid, ok := p.forwardDownlink[dlTeid]; ok {
+		session.ForwardDownlinkFteid = fteid
+	}
+	return session
+}
+
+// Warning: not thread safe
+func (p *PduSessionsManager) newTeidDl(ctx context.Context, session *PduSession) (uint32, error) {
 	// teid are attributed randomly, and unique per pdu session
+	// ctx is only checked after a collision: a free teid is never refused because the goroutine was descheduled
 	for {
+		if teid := rand.Uint32(); teid != 0 {
+			if _, exists := p.downlink[teid]; !exists {
+				p.downlink[teid] = session
+				return teid, nil
+			}
+		}
 		select {
 		case <-ctx.Done():
 			return 0, ctx.Err()
 		default:
-			teid := rand.Uint32()
-			if teid == 0 {
-				continue // bad luck :(
-			}
-			if _, exists := p.Downlink[teid]; !exists {
-				p.Downlink[teid] = ueControlURI
-				return teid, nil
-			}
 		}
 	}
 }
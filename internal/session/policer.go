@@ -0,0 +1,187 @@
+// Copyright Louis Royer and the NextMN contributors. All rights reserved.
+// Use of this source code is governed by a MIT-style license that can be
+// found in the LICENSE file.
+// SPDX-License-Identifier: MIT
+
+package session
+
+import (
+	"time"
+
+	"github.com/nextmn/json-api/jsonapi"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Token buckets allow bursts of POLICING_BURST_DURATION at the policed bit rate
+// (and at least MIN_BUCKET_SIZE bytes, so full-sized packets can go through at low rates).
+const (
+	POLICING_BURST_DURATION = 100 * time.Millisecond
+	MIN_BUCKET_SIZE         = 3000 // bytes
+)
+
+// Policed bit rate, in bits per second (0: no policing)
+type BitRate struct {
+	Uplink   uint64 `json:"uplink"`
+	Downlink uint64 `json:"downlink"`
+}
+
+type DirectionCounters struct {
+	Uplink   uint64 `json:"uplink"`
+	Downlink uint64 `json:"downlink"`
+}
+
+func (c *DirectionCounters) count(uplink bool) {
+	if uplink {
+		c.Uplink++
+	} else {
+		c.Downlink++
+	}
+}
+
+// Packets dropped by the gNB, by exceeded bit rate
+type PolicingDrops struct {
+	UeAmbr      DirectionCounters `json:"ue-ambr"`
+	SessionAmbr DirectionCounters `json:"session-ambr"`
+	Mfbr        DirectionCounters `json:"mfbr"`
+}
+
+type flowBuckets struct {
+	ul  *tokenBucket
+	dl  *tokenBucket
+	gbr bool
+}
+
+type tokenBucket struct {
+	rate   float64 // bytes per second
+	size   float64 // bytes
+	tokens float64 // bytes
+	last   time.Time
+}
+
+// Returns a full token bucket for the bit rate, or nil when the bit rate is 0 (no policing)
+func newTokenBucket(bitrate uint64) *tokenBucket {
+	if bitrate == 0 {
+		return nil
+	}
+	rate := float64(bitrate) / 8
+	size := max(rate*POLICING_BURST_DURATION.Seconds(), MIN_BUCKET_SIZE)
+	return &tokenBucket{
+		rate:   rate,
+		size:   size,
+		tokens: size,
+		last:   time.Now(),
+	}
+}
+
+// Returns true if a packet of this size conforms to the bit rate
+// Warning: not thread safe
+func (b *tokenBucket) conforms(size int, now time.Time) bool {
+	if b == nil {
+		return true
+	}
+	if elapsed := now.Sub(b.last).Seconds(); elapsed > 0 {
+		b.tokens = min(b.tokens+elapsed*b.rate, b.size)
+		b.last = now
+	}
+	return b.tokens >= float64(size)
+}
+
+// Warning: not thread safe
+func (b *tokenBucket) consume(size int) {
+	if b != nil {
+		b.tokens -= float64(size)
+	}
+}
+
+// Returns the UL and DL token buckets for the bit rate
+func newTokenBuckets(rate *BitRate) (*tokenBucket, *tokenBucket) {
+	if rate == nil {
+		return nil, nil
+	}
+	return newTokenBucket(rate.Uplink), newTokenBucket(rate.Downlink)
+}
+
+// Returns true if the packet of this PDU Session (and QoS Flow, when qfi != 0) conforms to
+// the MFBR of the QoS Flow, the Session-AMBR, and the UE-AMBR. Otherwise, the drop is counted.
+// As in TS 23.501, AMBRs only apply to Non-GBR QoS Flows.
+// Warning: session must be locked
+func (p *PduSessionsManager) police(session *PduSession, qfi uint8, size int, uplink bool) bool {
+	now := time.Now()
+	var mfbr, sessionAmbr, ueAmbr *tokenBucket
+	gbr := false
+	if flow, ok := session.qosFlowBuckets[qfi]; ok && qfi != 0 {
+		mfbr = flow.dl
+		if uplink {
+			mfbr = flow.ul
+		}
+		gbr = flow.gbr
+	}
+	if !gbr {
+		sessionAmbr = session.dlAmbr
+		if uplink {
+			sessionAmbr = session.ulAmbr
+		}
+		if session.ue != nil {
+			session.ue.ambrLock.Lock()
+			defer session.ue.ambrLock.Unlock()
+			ueAmbr = session.ue.dlAmbr
+			if uplink {
+				ueAmbr = session.ue.ulAmbr
+			}
+		}
+	}
+	var drops *DirectionCounters
+	switch {
+	case !mfbr.conforms(size, now):
+		drops = &session.PolicingDrops.Mfbr
+	case !sessionAmbr.conforms(size, now):
+		drops = &session.PolicingDrops.SessionAmbr
+	case !ueAmbr.conforms(size, now):
+		drops = &session.PolicingDrops.UeAmbr
+	default:
+		mfbr.consume(size)
+		sessionAmbr.consume(size)
+		ueAmbr.consume(size)
+		return true
+	}
+	drops.count(uplink)
+	logrus.WithFields(logrus.Fields{
+		"ue":             session.UeCtrl.String(),
+		"pdu-session-id": session.PduSessionId,
+		"qfi":            qfi,
+		"uplink":         uplink,
+	}).Trace("Packet dropped: bit rate exceeded")
+	return false
+}
+
+// Returns true if the DL packet received on this TEID (and QoS Flow, when qfi != 0) conforms to the policed bit rates
+func (p *PduSessionsManager) PoliceDownlink(dlTeid uint32, qfi uint8, size int) bool {
+	session, ok := p.tables.downlink.Load(dlTeid)
+	if !ok {
+		return true
+	}
+	session.lock.Lock()
+	defer session.lock.Unlock()
+	return p.police(session, qfi, size, false)
+}
+
+// Sets the bit rates used when UE-AMBR or Session-AMBR are not provided in session setup messages
+func (p *PduSessionsManager) SetDefaultAmbr(ueAmbr *BitRate, sessionAmbr *BitRate) {
+	p.Lock()
+	defer p.Unlock()
+	p.defaultUeAmbr = ueAmbr
+	p.defaultSessionAmbr = sessionAmbr
+}
+
+// Sets the UE-AMBR of the UE (replacing the previous one)
+func (p *PduSessionsManager) SetUeAmbr(ueControlURI jsonapi.ControlURI, ueAmbr *BitRate) error {
+	p.Lock()
+	defer p.Unlock()
+	ue, ok := p.ues[ueControlURI.String()]
+	if !ok {
+		return ErrPduSessionNotFound
+	}
+	ue.setAmbr(ueAmbr)
+	return nil
+}
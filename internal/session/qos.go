@@ -0,0 +1,224 @@
+// Copyright Louis Royer and the NextMN contributors. All rights reserved.
+// Use of this source code is governed by a MIT-style license that can be
+// found in the LICENSE file.
+// SPDX-License-Identifier: MIT
+
+package session
+
+import (
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/wmnsk/go-gtp/gtpv1/message"
+)
+
+const (
+	DEFAULT_REFLECTIVE_QOS_TIMER = 60 * time.Second
+	DERIVED_QOS_RULE_PRECEDENCE  = 80   // TS 24.501
+	MAX_DERIVED_QOS_RULES        = 1024 // per PDU Session
+)
+
+type derivedQosRule struct {
+	qfi       uint8
+	expiresAt time.Time
+}
+
+type QosFlowCounters struct {
+	UplinkPackets   uint64 `json:"uplink-packets"`
+	DownlinkPackets uint64 `json:"downlink-packets"`
+}
+
+// Returns true if the QoS Flow belongs to the PDU Session
+func (s *PduSession) hasQosFlow(qfi uint8) bool {
+	for _, flow := range s.QosFlows {
+		if flow.Qfi == qfi {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns the QFI of the default QoS rule (or the first QoS Flow)
+func (s *PduSession) defaultQfi() (uint8, bool) {
+	if len(s.QosFlows) == 0 {
+		return 0, false
+	}
+	for _, flow := range s.QosFlows {
+		if flow.Default {
+			return flow.Qfi, true
+		}
+	}
+	return s.QosFlows[0].Qfi, true
+}
+
+// Returns the QFI of the first QoS rule matching the UL packet (signalled or derived QoS rules).
+// Warning: not thread safe
+func (s *PduSession) classify(pkt []byte) (uint8, bool) {
+	t, dscp, ok := parseFiveTuple(pkt, true)
+	if !ok {
+		return 0, false
+	}
+	derived, hasDerived := s.derivedQosRule(t)
+	for _, rule := range s.QosRules {
+		if hasDerived && rule.Precedence >= DERIVED_QOS_RULE_PRECEDENCE {
+			break
+		}
+		if len(rule.PacketFilters) == 0 {
+			return rule.Qfi, true
+		}
+		for _, f := range rule.PacketFilters {
+			if f.matches(t, dscp) {
+				return rule.Qfi, true
+			}
+		}
+	}
+	return derived, hasDerived
+}
+
+// Returns the QFI of the derived QoS rule for this 5-tuple, removing it once expired.
+// Warning: not thread safe
+func (s *PduSession) derivedQosRule(t fiveTuple) (uint8, bool) {
+	rule, ok := s.derivedQosRules[t]
+	if !ok {
+		return 0, false
+	}
+	if time.Now().After(rule.expiresAt) {
+		delete(s.derivedQosRules, t)
+		return 0, false
+	}
+	return rule.qfi, true
+}
+
+// Creates (or refreshes) the UL QoS rule derived from a DL packet received with RQI set.
+// Returns true when the rule is new, or its QFI changed.
+// Warning: not thread safe
+func (s *PduSession) deriveQosRule(pkt []byte, qfi uint8, timer time.Duration) bool {
+	t, _, ok := parseFiveTuple(pkt, false)
+	if !ok {
+		return false
+	}
+	if s.derivedQosRules == nil {
+		s.derivedQosRules = make(map[fiveTuple]derivedQosRule)
+	}
+	old, exists := s.derivedQosRules[t]
+	if !exists && len(s.derivedQosRules) >= MAX_DERIVED_QOS_RULES {
+		s.sweepDerivedQosRules()
+	}
+	s.derivedQosRules[t] = derivedQosRule{
+		qfi:       qfi,
+		expiresAt: time.Now().Add(timer),
+	}
+	return !exists || old.qfi != qfi || time.Now().After(old.expiresAt)
+}
+
+// Removes expired derived QoS rules; when none has expired, the one expiring first is removed.
+// Warning: not thread safe
+func (s *PduSession) sweepDerivedQosRules() {
+	now := time.Now()
+	var first fiveTuple
+	var firstExpiresAt time.Time
+	for t, rule := range s.derivedQosRules {
+		if now.After(rule.expiresAt) {
+			delete(s.derivedQosRules, t)
+		} else if firstExpiresAt.IsZero() || rule.expiresAt.Before(firstExpiresAt) {
+			first, firstExpiresAt = t, rule.expiresAt
+		}
+	}
+	if len(s.derivedQosRules) >= MAX_DERIVED_QOS_RULES {
+		delete(s.derivedQosRules, first)
+	}
+}
+
+// Returns the derived QoS rules not yet expired
+// Warning: not thread safe
+func (s *PduSession) derivedQosRulesList() []QosRule {
+	var rules []QosRule
+	now := time.Now()
+	for t, rule := range s.derivedQosRules {
+		if now.After(rule.expiresAt) {
+			continue
+		}
+		rules = append(rules, QosRule{
+			Precedence:    DERIVED_QOS_RULE_PRECEDENCE,
+			Qfi:           rule.qfi,
+			PacketFilters: []PacketFilter{t.filter()},
+		})
+	}
+	return rules
+}
+
+// Warning: not thread safe
+func (s *PduSession) countQos(qfi uint8, uplink bool) {
+	if s.QosCounters == nil {
+		s.QosCounters = make(map[uint8]QosFlowCounters)
+	}
+	counters := s.QosCounters[qfi]
+	if uplink {
+		counters.UplinkPackets++
+	} else {
+		counters.DownlinkPackets++
+	}
+	s.QosCounters[qfi] = counters
+}
+
+// Returns the extension headers of an UL G-PDU for this PDU Session.
+// The QoS Flow requested by the UE is used if it belongs to the PDU Session (qfi != 0),
+// otherwise the QoS Flow of the first matching QoS rule, or the QoS Flow of the default QoS rule.
+// No PDU Session Container is used for PDU Sessions without QoS Flows nor QoS rules.
+// ErrBitRateExceeded is returned when the packet must be dropped.
+// Warning: session must be locked
+func (p *PduSessionsManager) uplinkContainer(session *PduSession, qfi uint8, pkt []byte) ([]*message.ExtensionHeader, error) {
+	if qfi != 0 && !session.hasQosFlow(qfi) {
+		logrus.WithFields(logrus.Fields{
+			"ue":             session.UeCtrl.String(),
+			"pdu-session-id": session.PduSessionId,
+			"qfi":            qfi,
+		}).Debug("Unknown QoS Flow requested by the UE: using QoS rules")
+		qfi = 0
+	}
+	if qfi == 0 && session.PduSessionType.IsIP() {
+		qfi, _ = session.classify(pkt)
+	}
+	if qfi == 0 {
+		qfi, _ = session.defaultQfi()
+	}
+	if !p.police(session, qfi, len(pkt), true) {
+		return nil, ErrBitRateExceeded
+	}
+	if qfi == 0 {
+		return nil, nil
+	}
+	session.countQos(qfi, true)
+	return []*message.ExtensionHeader{NewUlPduSessionContainer(qfi).ExtensionHeader()}, nil
+}
+
+// Accounts DL traffic received with a PDU Session Container on this TEID.
+// When RQI is set, an UL QoS rule is derived from the packet (reflective QoS).
+func (p *PduSessionsManager) HandleDownlinkContainer(dlTeid uint32, c PduSessionContainer, pkt []byte) {
+	session, ok := p.tables.downlink.Load(dlTeid)
+	if !ok {
+		return
+	}
+	session.lock.Lock()
+	defer session.lock.Unlock()
+	logger := logrus.WithFields(logrus.Fields{
+		"ue":             session.UeCtrl.String(),
+		"pdu-session-id": session.PduSessionId,
+		"qfi":            c.Qfi,
+		"rqi":            c.Rqi,
+	})
+	if c.Ppp {
+		logger = logger.WithField("ppi", c.Ppi)
+	}
+	if c.PduType != PDU_SESSION_CONTAINER_DL {
+		logger.WithField("pdu-type", c.PduType).Debug("Unexpected PDU Session Container type for DL traffic")
+	} else if !session.hasQosFlow(c.Qfi) {
+		logger.Debug("DL traffic received on unknown QoS Flow")
+	} else {
+		logger.Trace("DL traffic received on QoS Flow")
+	}
+	session.countQos(c.Qfi, false)
+	if c.Rqi && session.PduSessionType.IsIP() && session.deriveQosRule(pkt, c.Qfi, p.reflectiveQosTimer) {
+		logger.Debug("New derived QoS rule (reflective QoS)")
+	}
+}
@@ -0,0 +1,97 @@
+// Copyright Louis Royer and the NextMN contributors. All rights reserved.
+// Use of this source code is governed by a MIT-style license that can be
+// found in the LICENSE file.
+// SPDX-License-Identifier: MIT
+
+package session
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/nextmn/json-api/jsonapi"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+type PduSessionReleaseCommand struct {
+	// Header
+	UeCtrl jsonapi.ControlURI `json:"ue-ctrl"`
+	Cp     jsonapi.ControlURI `json:"cp"`
+	Gnb    jsonapi.ControlURI `json:"gnb"`
+
+	// Release Command
+	Sessions []Session `json:"sessions"` // sessions are identified by their PDU Session ID, DL FTEID, or UE address
+}
+
+type PduSessionReleaseComplete struct {
+	// Header
+	UeCtrl jsonapi.ControlURI `json:"ue-ctrl"`
+	Cp     jsonapi.ControlURI `json:"cp"`
+	Gnb    jsonapi.ControlURI `json:"gnb"`
+
+	// Release Complete
+	Sessions []Session `json:"sessions"` // list of pdu sessions actually released
+}
+
+// request from CP
+func (p *PduSessions) ReleaseCommand(c *gin.Context) {
+	var ps PduSessionReleaseCommand
+	if err := c.BindJSON(&ps); err != nil {
+		logrus.WithError(err).Error("could not deserialize")
+		c.JSON(http.StatusBadRequest, jsonapi.MessageWithError{Message: "could not deserialize", Error: err})
+		return
+	}
+	logrus.WithFields(logrus.Fields{
+		"ue": ps.UeCtrl.String(),
+	}).Info("New PDU Session Release Command")
+	p.StartProcedure(c, ps.UeCtrl, ProcReleaseCommand, func(ctx context.Context, _ UeState) (UeState, error) {
+		err := p.HandleReleaseCommand(ctx, ps)
+		return p.idleOr(ps.UeCtrl, UeStateConnected), err
+	})
+}
+
+// Release Command is send to the gNB by the Control Plane.
+// Upon receiving a Release Command, the gNB removes the PDU Sessions,
+// forwards the Release Command to the UE, and answers to the Control Plane with a Release Complete.
+func (p *PduSessions) HandleReleaseCommand(ctx context.Context, ps PduSessionReleaseCommand) error {
+	released := make([]Session, 0, len(ps.Sessions))
+	for _, session := range ps.Sessions {
+		pduSession, err := p.manager.ReleasePduSession(ps.UeCtrl, session)
+		if err != nil {
+			logrus.WithError(err).WithFields(logrus.Fields{
+				"ue":             ps.UeCtrl.String(),
+				"pdu-session-id": session.PduSessionId,
+				"ue-addr":        session.Addr,
+			}).Error("Could not release PDU Session")
+			continue
+		}
+		released = append(released, pduSession.Session())
+	}
+
+	// forward to UE
+	// PDU Sessions are already removed: the Release Complete is sent to the CP even if the UE could not be reached
+	errUe := p.Client.Post(ctx, ps.UeCtrl, "ps/release-command", ps)
+	if errUe != nil {
+		logrus.WithError(errUe).WithFields(logrus.Fields{
+			"ue": ps.UeCtrl.String(),
+		}).Error("Could not send ps/release-command")
+	}
+
+	// notify CP
+	rsp := PduSessionReleaseComplete{
+		// Header
+		UeCtrl: ps.UeCtrl,
+		Cp:     ps.Cp,
+		Gnb:    p.Control,
+		// Release Complete
+		Sessions: released,
+	}
+	errCp := p.Client.Post(ctx, p.Cp, "ps/release-complete", rsp)
+	if errCp != nil {
+		logrus.WithError(errCp).Error("Could not send ps/release-complete")
+	}
+	return errors.Join(errUe, errCp)
+}
@@ -0,0 +1,53 @@
+// Copyright Louis Royer and the NextMN contributors. All rights reserved.
+// Use of this source code is governed by a MIT-style license that can be
+// found in the LICENSE file.
+// SPDX-License-Identifier: MIT
+
+package session
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/nextmn/json-api/jsonapi"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+type PduSessionReleaseRequest struct {
+	// Header
+	UeCtrl jsonapi.ControlURI `json:"ue-ctrl"`
+	Gnb    jsonapi.ControlURI `json:"gnb"`
+
+	// Release Request
+	Sessions []Session `json:"sessions"` // list of pdu sessions of the UE to be released
+}
+
+// request from UE
+func (p *PduSessions) ReleaseRequest(c *gin.Context) {
+	var ps PduSessionReleaseRequest
+	if err := c.BindJSON(&ps); err != nil {
+		logrus.WithError(err).Error("could not deserialize")
+		c.JSON(http.StatusBadRequest, jsonapi.MessageWithError{Message: "could not deserialize", Error: err})
+		return
+	}
+	logrus.WithFields(logrus.Fields{
+		"ue": ps.UeCtrl.String(),
+	}).Info("New PDU Session Release Request")
+	p.StartProcedure(c, ps.UeCtrl, ProcReleaseRequest, func(ctx context.Context, _ UeState) (UeState, error) {
+		return onSuccess(UeStateReleasing, p.HandleReleaseRequest(ctx, ps))
+	})
+}
+
+// Release Request is send by the UE to the gNB.
+// Upon receiving a Release Request, the gNB forwards it to the Control Plane,
+// which will answer with a Release Command.
+func (p *PduSessions) HandleReleaseRequest(ctx context.Context, ps PduSessionReleaseRequest) error {
+	// forward to cp
+	if err := p.Client.Post(ctx, p.Cp, "ps/release-request", ps); err != nil {
+		logrus.WithError(err).Error("Could not send ps/release-request")
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,56 @@
+// Copyright Louis Royer and the NextMN contributors. All rights reserved.
+// Use of this source code is governed by a MIT-style license that can be
+// found in the LICENSE file.
+// SPDX-License-Identifier: MIT
+
+package session
+
+import (
+	"net/http"
+	"net/netip"
+	"strconv"
+
+	"github.com/nextmn/json-api/jsonapi"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+// list PDU Sessions, optionally filtered by UE address (`?ue-addr=`)
+func (p *PduSessions) List(c *gin.Context) {
+	sessions := p.manager.PduSessions()
+	if ueAddr, ok := c.GetQuery("ue-addr"); ok {
+		addr, err := netip.ParseAddr(ueAddr)
+		if err != nil {
+			logrus.WithError(err).Error("could not parse UE address")
+			c.JSON(http.StatusBadRequest, jsonapi.MessageWithError{Message: "could not parse UE address", Error: err})
+			return
+		}
+		filtered := make([]PduSession, 0, len(sessions))
+		for _, session := range sessions {
+			if session.HasAddr(addr) {
+				filtered = append(filtered, session)
+			}
+		}
+		sessions = filtered
+	}
+	c.Header("Cache-Control", "no-cache")
+	c.JSON(http.StatusOK, sessions)
+}
+
+// get a PDU Session by its DL TEID
+func (p *PduSessions) Get(c *gin.Context) {
+	teid, err := strconv.ParseUint(c.Param("teid"), 0, 32)
+	if err != nil {
+		logrus.WithError(err).Error("could not parse TEID")
+		c.JSON(http.StatusBadRequest, jsonapi.MessageWithError{Message: "could not parse TEID", Error: err})
+		return
+	}
+	session, err := p.manager.PduSession(uint32(teid))
+	if err != nil {
+		c.JSON(http.StatusNotFound, jsonapi.MessageWithError{Message: "could not find PDU Session", Error: err})
+		return
+	}
+	c.Header("Cache-Control", "no-cache")
+	c.JSON(http.StatusOK, session)
+}
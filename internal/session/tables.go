@@ -0,0 +1,115 @@
+// Copyright Louis Royer and the NextMN contributors. All rights reserved.
+// Use of this source code is governed by a MIT-style license that can be
+// found in the LICENSE file.
+// SPDX-License-Identifier: MIT
+
+package session
+
+import (
+	"hash/maphash"
+	"maps"
+	"net/netip"
+	"sync/atomic"
+
+	"github.com/nextmn/json-api/jsonapi"
+)
+
+// Number of shards of each lookup table
+const TABLE_SHARDS = 256
+
+// PDU Session of a UE, identified by its PDU Session ID
+type ueSessionKey struct {
+	ue  string // ue control uri
+	psi uint8
+}
+
+// Copy-on-write map split in shards: lookups never lock, and an update only copies the shard of the key,
+// so bringing up N PDU Sessions copies about N²/(2*TABLE_SHARDS) entries instead of N²/2.
+type cowMap[K comparable, V any] struct {
+	seed   maphash.Seed
+	shards [TABLE_SHARDS]atomic.Pointer[map[K]V]
+}
+
+func (m *cowMap[K, V]) init() {
+	m.seed = maphash.MakeSeed()
+}
+
+func (m *cowMap[K, V]) shard(key K) *atomic.Pointer[map[K]V] {
+	return &m.shards[maphash.Comparable(m.seed, key)%TABLE_SHARDS]
+}
+
+func (m *cowMap[K, V]) Load(key K) (V, bool) {
+	shard := m.shard(key).Load()
+	if shard == nil {
+		var zero V
+		return zero, false
+	}
+	v, ok := (*shard)[key]
+	return v, ok
+}
+
+// Warning: not thread safe (updates must be serialised)
+func (m *cowMap[K, V]) Store(key K, value V) {
+	shard := m.shard(key)
+	var updated map[K]V
+	if old := shard.Load(); old != nil {
+		updated = maps.Clone(*old)
+	} else {
+		updated = make(map[K]V, 1)
+	}
+	updated[key] = value
+	shard.Store(&updated)
+}
+
+// Warning: not thread safe (updates must be serialised)
+func (m *cowMap[K, V]) Delete(key K) {
+	shard := m.shard(key)
+	old := shard.Load()
+	if old == nil {
+		return
+	}
+	if _, ok := (*old)[key]; !ok {
+		return
+	}
+	updated := maps.Clone(*old)
+	delete(updated, key)
+	shard.Store(&updated)
+}
+
+func (m *cowMap[K, V]) Len() int {
+	n := 0
+	for i := range m.shards {
+		if shard := m.shards[i].Load(); shard != nil {
+			n += len(*shard)
+		}
+	}
+	return n
+}
+
+// Lookup tables used on the packet path.
+// Control updates modify the tables of the manager (under its lock), and the same entries of these tables,
+// so packets can be handled without locking the manager.
+// A PDU Session is added to these tables once fully initialised.
+type sessionTables struct {
+	downlink        cowMap[uint32, *PduSession]       // teid: PDU Session
+	forwardDownlink cowMap[uint32, *jsonapi.Fteid]    // teid: forwarding tunnel (source gNB during handover)
+	uplink          cowMap[netip.Addr, *PduSession]   // ue 5G ipv4 address: IP PDU Session
+	uplinkV6        cowMap[netip.Prefix, *PduSession] // ue 5G ipv6 prefix (/64): IP PDU Session
+	ueSessions      cowMap[ueSessionKey, *PduSession] // ue and pdu session id: PDU Session (radio frames)
+}
+
+func (t *sessionTables) init() {
+	t.downlink.init()
+	t.forwardDownlink.init()
+	t.uplink.init()
+	t.uplinkV6.init()
+	t.ueSessions.init()
+}
+
+// Returns the IP PDU Session of the UE using this source address
+func (t *sessionTables) uplinkSession(src netip.Addr) (*PduSession, bool) {
+	if src.Is4() {
+		return t.uplink.Load(src)
+	}
+	return t.uplinkV6.Load(ipv6Prefix(src))
+}
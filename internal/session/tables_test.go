@@ -0,0 +1,131 @@
+// Copyright Louis Royer and the NextMN contributors. All rights reserved.
+// Use of this source code is governed by a MIT-style license that can be
+// found in the LICENSE file.
+// SPDX-License-Identifier: MIT
+
+package session
+
+import (
+	"context"
+	"fmt"
+	"net/netip"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/nextmn/json-api/jsonapi"
+	"github.com/nextmn/json-api/jsonapi/n1n2"
+)
+
+type discardN3Writer struct{}
+
+func (discardN3Writer) WriteToUDPAddrPort(b []byte, addr netip.AddrPort) (int, error) {
+	return len(b), nil
+}
+
+// Minimal IPv4 packet sent by the UE
+func uplinkPacket(src netip.Addr) []byte {
+	pkt := make([]byte, 28)
+	pkt[0] = 0x45
+	pkt[9] = 17 // UDP
+	copy(pkt[12:16], src.AsSlice())
+	copy(pkt[16:20], []byte{192, 0, 2, 1})
+	return pkt
+}
+
+// Control updates run concurrently with the packet path: run with -race
+func TestSessionTablesConcurrency(t *testing.T) {
+	const ues = 8
+	duration := time.Second
+	if testing.Short() {
+		duration = 100 * time.Millisecond
+	}
+	gnb := netip.MustParseAddr("198.51.100.10")
+	upf := netip.MustParseAddr("198.51.100.1")
+	p := NewPduSessionsManager([]N3Address{{Addr: gnb}}, 0, 0)
+	p.SetN3Writer(gnb, discardN3Writer{})
+
+	ctx, cancel := context.WithTimeout(context.Background(), duration)
+	defer cancel()
+
+	ueCtrls := make([]jsonapi.ControlURI, ues)
+	ueAddrs := make([]netip.Addr, ues)
+	for i := range ues {
+		ctrl, err := jsonapi.ParseControlURI(fmt.Sprintf("http://192.0.2.%d:8080", i+1))
+		if err != nil {
+			t.Fatal(err)
+		}
+		ueCtrls[i] = *ctrl
+		ueAddrs[i] = netip.AddrFrom4([4]byte{10, 0, 0, byte(i + 1)})
+	}
+	var dlTeids [ues]atomic.Uint32 // last DL TEID allocated for each UE
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 2*ues)
+	for i := range ues {
+		// control plane
+		wg.Go(func() {
+			ulFteid := jsonapi.NewFteid(upf, uint32(i+1))
+			s := Session{
+				Session: n1n2.Session{
+					Addr:        ueAddrs[i],
+					Dnn:         "internet",
+					UplinkFteid: ulFteid,
+				},
+				PduSessionId: 1,
+			}
+			for n := 0; ctx.Err() == nil; n++ {
+				ps, err := p.NewPduSession(context.Background(), ueCtrls[i], s)
+				if err != nil {
+					errs <- err
+					return
+				}
+				dlTeids[i].Store(ps.DownlinkFteid.Teid)
+				switch n % 3 {
+				case 0:
+					if err := p.AwaitEndMarker(ps.DownlinkFteid.Teid); err != nil {
+						errs <- err
+						return
+					}
+					_, err = p.ReleasePduSession(ueCtrls[i], s)
+				case 1:
+					if err := p.StartForwarding(ueCtrls[i], s, jsonapi.NewFteid(gnb, uint32(n))); err != nil {
+						errs <- err
+						return
+					}
+					_, err = p.ReleasePduSession(ueCtrls[i], s)
+				case 2:
+					_, err = p.ReleaseUplinkFteid(*ulFteid)
+				}
+				if err != nil {
+					errs <- err
+					return
+				}
+			}
+		})
+		// packet path
+		wg.Go(func() {
+			pkt := uplinkPacket(ueAddrs[i])
+			for ctx.Err() == nil {
+				_ = p.WriteUplink(ctx, pkt)
+				teid := dlTeids[i].Load()
+				if ue, err := p.GetUECtrl(teid); err == nil && ue != ueCtrls[i] {
+					errs <- fmt.Errorf("DL TEID %d of UE %s is used by UE %s", teid, ueCtrls[i].String(), ue.String())
+					return
+				}
+				_, _ = p.GetForwarding(teid)
+				p.HoldDownlink(teid, gnb, pkt) // forwarded DL traffic
+				p.HoldDownlink(teid, upf, pkt)
+			}
+		})
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+	if n := p.tables.downlink.Len(); n != 0 {
+		t.Errorf("%d PDU Sessions not released", n)
+	}
+}
@@ -0,0 +1,60 @@
+// Copyright Louis Royer and the NextMN contributors. All rights reserved.
+// Use of this source code is governed by a MIT-style license that can be
+// found in the LICENSE file.
+// SPDX-License-Identifier: MIT
+
+package session
+
+import (
+	"sync"
+	"time"
+)
+
+// Timers run a function once a deadline is reached, unless stopped before.
+// Each timer is identified by a DL TEID.
+type Timers struct {
+	sync.Mutex
+
+	timers map[uint32]*time.Timer // teid: timer
+}
+
+func NewTimers() *Timers {
+	return &Timers{
+		timers: make(map[uint32]*time.Timer),
+	}
+}
+
+// Start a timer for this teid, replacing any previous one
+func (t *Timers) Start(teid uint32, d time.Duration, f func()) {
+	t.Lock()
+	defer t.Unlock()
+	if old, ok := t.timers[teid]; ok {
+		old.Stop()
+	}
+	var timer *time.Timer
+	timer = time.AfterFunc(d, func() {
+		t.Lock()
+		if t.timers[teid] != timer {
+			// timer has been stopped or replaced in the meantime
+			t.Unlock()
+			return
+		}
+		delete(t.timers, teid)
+		t.Unlock()
+		f()
+	})
+	t.timers[teid] = timer
+}
+
+// Stop the timer for this teid; returns false if there was no running timer
+func (t *Timers) Stop(teid uint32) bool {
+	t.Lock()
+	defer t.Unlock()
+	timer, ok := t.timers[teid]
+	if !ok {
+		return false
+	}
+	delete(t.timers, teid)
+	timer.Stop()
+	return true
+}
@@ -0,0 +1,76 @@
+// Copyright Louis Royer and the NextMN contributors. All rights reserved.
+// Use of this source code is governed by a MIT-style license that can be
+// found in the LICENSE file.
+// SPDX-License-Identifier: MIT
+
+package session
+
+import (
+	"sync"
+
+	"github.com/nextmn/json-api/jsonapi"
+)
+
+// PDU Session IDs are in range [1, 15]
+const (
+	MIN_PDU_SESSION_ID = 1
+	MAX_PDU_SESSION_ID = 15
+)
+
+// UE Context holds every PDU Session of the UE
+type UeContext struct {
+	UeCtrl   jsonapi.ControlURI
+	Sessions map[uint8]*PduSession // pdu session id: PDU Session
+	UeAmbr   *BitRate
+
+	ambrLock sync.Mutex // protects UE-AMBR token buckets, used on the packet path
+	ulAmbr   *tokenBucket
+	dlAmbr   *tokenBucket
+}
+
+func NewUeContext(ueCtrl jsonapi.ControlURI) *UeContext {
+	return &UeContext{
+		UeCtrl:   ueCtrl,
+		Sessions: make(map[uint8]*PduSession),
+	}
+}
+
+func (u *UeContext) setAmbr(ueAmbr *BitRate) {
+	u.ambrLock.Lock()
+	defer u.ambrLock.Unlock()
+	u.UeAmbr = ueAmbr
+	u.ulAmbr, u.dlAmbr = newTokenBuckets(ueAmbr)
+}
+
+// Returns the lowest PDU Session ID not used by the UE
+func (u *UeContext) newPduSessionId() (uint8, error) {
+	for psi := uint8(MIN_PDU_SESSION_ID); psi <= MAX_PDU_SESSION_ID; psi++ {
+		if _, exists := u.Sessions[psi]; !exists {
+			return psi, nil
+		}
+	}
+	return 0, ErrNoPduSessionIdAvailable
+}
+
+// Returns the PDU Session described by s:
+// by PDU Session ID if provided, else by DL TEID, else by UE address.
+func (u *UeContext) lookup(s Session) (*PduSession, bool) {
+	if s.PduSessionId != 0 {
+		session, ok := u.Sessions[s.PduSessionId]
+		return session, ok
+	}
+	for _, session := range u.Sessions {
+		if s.DownlinkFteid != nil && session.DownlinkFteid != nil && *session.DownlinkFteid == *s.DownlinkFteid {
+			return session, true
+		}
+	}
+	if !s.Addr.IsValid() {
+		return nil, false
+	}
+	for _, session := range u.Sessions {
+		if session.HasAddr(s.Addr) {
+			return session, true
+		}
+	}
+	return nil, false
+}
@@ -0,0 +1,255 @@
+// Copyright Louis Royer and the NextMN contributors. All rights reserved.
+// Use of this source code is governed by a MIT-style license that can be
+// found in the LICENSE file.
+// SPDX-License-Identifier: MIT
+
+package session
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/nextmn/gnb-lite/internal/metrics"
+
+	"github.com/nextmn/json-api/jsonapi"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+type UeState string
+
+const (
+	UeStateIdle              UeState = "idle" // no PDU Session
+	UeStateEstablishing      UeState = "establishing"
+	UeStateConnected         UeState = "connected"
+	UeStateHandoverPreparing UeState = "handover-preparing"
+	UeStateHandoverExecuting UeState = "handover-executing" // source gNB: UE is leaving; target gNB: waiting for the UE
+	UeStateReleasing         UeState = "releasing"
+)
+
+// A procedure changes the state of the UE.
+// Procedures of the same UE are serialised.
+type Procedure struct {
+	Name   string
+	From   []UeState // states in which the procedure is allowed (any state when empty)
+	During UeState   // state while the procedure is running (unchanged when empty)
+}
+
+var (
+	// UE
+	ProcEstablishmentRequest = Procedure{Name: "establishment-request", From: []UeState{UeStateIdle, UeStateEstablishing, UeStateConnected}, During: UeStateEstablishing}
+	ProcReleaseRequest       = Procedure{Name: "release-request", From: []UeState{UeStateConnected}, During: UeStateReleasing}
+	ProcHandoverConfirm      = Procedure{Name: "handover-confirm", From: []UeState{UeStateHandoverExecuting}}
+
+	// CP
+	ProcN2EstablishmentRequest = Procedure{Name: "n2-establishment-request", From: []UeState{UeStateIdle, UeStateEstablishing, UeStateConnected}, During: UeStateEstablishing}
+	ProcReleaseCommand         = Procedure{Name: "release-command", From: []UeState{UeStateEstablishing, UeStateConnected, UeStateReleasing}, During: UeStateReleasing}
+	ProcPathSwitchRequestAck   = Procedure{Name: "path-switch-request-ack", From: []UeState{UeStateHandoverExecuting}}
+
+	// source gNB
+	ProcHandover                   = Procedure{Name: "handover", From: []UeState{UeStateConnected}, During: UeStateHandoverPreparing}
+	ProcHandoverCommand            = Procedure{Name: "handover-command", From: []UeState{UeStateHandoverPreparing}, During: UeStateHandoverExecuting}
+	ProcXnHandoverRequestAck       = Procedure{Name: "xn-handover-request-ack", From: []UeState{UeStateHandoverPreparing}, During: UeStateHandoverExecuting}
+	ProcHandoverPreparationFailure = Procedure{Name: "handover-preparation-failure", From: []UeState{UeStateHandoverPreparing}}
+	ProcHandoverCancellation       = Procedure{Name: "handover-cancellation", From: []UeState{UeStateHandoverPreparing, UeStateHandoverExecuting}}
+	ProcUeContextRelease           = Procedure{Name: "ue-context-release", From: []UeState{UeStateHandoverExecuting}}
+
+	// target gNB
+	ProcHandoverRequest = Procedure{Name: "handover-request", From: []UeState{UeStateIdle, UeStateHandoverExecuting}, During: UeStateHandoverPreparing}
+	ProcHandoverCancel  = Procedure{Name: "handover-cancel", From: []UeState{UeStateHandoverPreparing, UeStateHandoverExecuting}}
+
+	// every PDU Session of the UE has been removed (End Marker, timer, Error Indication, …)
+	procUeContextRemoval = Procedure{Name: "ue-context-removal"}
+)
+
+func (p Procedure) allowed(state UeState) bool {
+	return len(p.From) == 0 || slices.Contains(p.From, state)
+}
+
+type UeStatus struct {
+	Ue                 jsonapi.ControlURI `json:"ue"`
+	State              UeState            `json:"state"`
+	Procedure          string             `json:"procedure,omitempty"` // procedure in progress
+	LastError          string             `json:"last-error,omitempty"`
+	LastErrorProcedure string             `json:"last-error-procedure,omitempty"`
+	UpdatedAt          time.Time          `json:"updated-at"`
+}
+
+type ueStateMachine struct {
+	procedure sync.Mutex // serialises procedures of the UE
+	users     int        // procedures running or waiting (protected by PduSessions.ueLock)
+
+	sync.Mutex // protects status
+	status     UeStatus
+	enteredAt  time.Time // when the current state was entered
+}
+
+func (m *ueStateMachine) state() UeState {
+	m.Lock()
+	defer m.Unlock()
+	return m.status.State
+}
+
+func (m *ueStateMachine) set(state UeState, procedure string) {
+	m.Lock()
+	defer m.Unlock()
+	now := time.Now()
+	if m.status.State != state {
+		m.enteredAt = now
+	}
+	m.status.State = state
+	m.status.Procedure = procedure
+	m.status.UpdatedAt = now
+}
+
+// Returns for how long the UE has been in its current state
+func (m *ueStateMachine) since() time.Duration {
+	m.Lock()
+	defer m.Unlock()
+	return time.Since(m.enteredAt)
+}
+
+func (m *ueStateMachine) fail(procedure string, err error) {
+	m.Lock()
+	defer m.Unlock()
+	m.status.LastError = err.Error()
+	m.status.LastErrorProcedure = procedure
+}
+
+// Returns the state machine of the UE (created in idle state).
+// It must be released once the procedure is finished.
+func (s *PduSessions) acquireUeStateMachine(ue jsonapi.ControlURI) *ueStateMachine {
+	s.ueLock.Lock()
+	defer s.ueLock.Unlock()
+	m, ok := s.ueStates[ue.String()]
+	if !ok {
+		now := time.Now()
+		m = &ueStateMachine{status: UeStatus{Ue: ue, State: UeStateIdle, UpdatedAt: now}, enteredAt: now}
+		s.ueStates[ue.String()] = m
+	}
+	m.users++
+	return m
+}
+
+// The state machine of an idle UE is removed once no procedure is using it
+func (s *PduSessions) releaseUeStateMachine(ue jsonapi.ControlURI, m *ueStateMachine) {
+	s.ueLock.Lock()
+	defer s.ueLock.Unlock()
+	m.users--
+	if m.users == 0 && m.state() == UeStateIdle {
+		delete(s.ueStates, ue.String())
+	}
+}
+
+// Runs the procedure once previous procedures of the UE are finished.
+// The procedure is rejected when not allowed in the current state of the UE.
+// fn receives the state of the UE before the procedure, and returns the new state (unchanged when empty);
+// the error returned by fn is recorded as the last error of the UE.
+// Messages sent by fn use ctx, which is done after the procedure timeout: procedures of the UE waiting meanwhile
+// (including Handover Cancel and releases) are not blocked by an unreachable peer for longer.
+func (s *PduSessions) runProcedure(ue jsonapi.ControlURI, proc Procedure, fn func(ctx context.Context, prev UeState) (UeState, error)) error {
+	m := s.acquireUeStateMachine(ue)
+	defer s.releaseUeStateMachine(ue, m)
+	m.procedure.Lock()
+	defer m.procedure.Unlock()
+	ctx, cancel := context.WithTimeout(s.Context(), s.procedureTimeout)
+	defer cancel()
+
+	prev := m.state()
+	logger := logrus.WithFields(logrus.Fields{
+		"ue":        ue.String(),
+		"procedure": proc.Name,
+		"state":     prev,
+	})
+	if !proc.allowed(prev) {
+		err := fmt.Errorf("%w: %s in state %s", ErrIllegalTransition, proc.Name, prev)
+		m.fail(proc.Name, err)
+		logger.WithError(err).Error("Procedure rejected")
+		return err
+	}
+	prevDuration := m.since()
+	during := prev
+	if proc.During != "" {
+		during = proc.During
+	}
+	m.set(during, proc.Name)
+
+	next, err := fn(ctx, prev)
+	if next == "" {
+		next = prev
+	}
+	if err != nil {
+		m.fail(proc.Name, err)
+	} else if prev == UeStateHandoverPreparing && next == UeStateHandoverExecuting {
+		switch proc.Name {
+		case ProcHandoverCommand.Name:
+			metrics.HandoverPreparation(HANDOVER_TYPE_N2, prevDuration)
+		case ProcXnHandoverRequestAck.Name:
+			metrics.HandoverPreparation(HANDOVER_TYPE_XN, prevDuration)
+		}
+	}
+	m.set(next, "")
+	if next != prev {
+		logger.WithField("new-state", next).Info("UE state changed")
+	}
+	return err
+}
+
+// Runs the procedure in background (see runProcedure), and answers the control API call
+func (s *PduSessions) StartProcedure(c *gin.Context, ue jsonapi.ControlURI, proc Procedure, fn func(ctx context.Context, prev UeState) (UeState, error)) {
+	s.procedures.Start(c, ue, proc.Name, func() error {
+		return s.runProcedure(ue, proc, fn)
+	})
+}
+
+// Returns next when err is nil, otherwise the state of the UE is unchanged
+func onSuccess(next UeState, err error) (UeState, error) {
+	if err != nil {
+		return "", err
+	}
+	return next, nil
+}
+
+// Returns idle when the UE has no PDU Session anymore, otherwise returns state
+func (s *PduSessions) idleOr(ue jsonapi.ControlURI, state UeState) UeState {
+	if !s.manager.HasUeContext(ue) {
+		return UeStateIdle
+	}
+	return state
+}
+
+// Called when every PDU Session of the UE has been removed
+func (s *PduSessions) ueContextRemoved(ue jsonapi.ControlURI) {
+	s.runProcedure(ue, procUeContextRemoval, func(_ context.Context, prev UeState) (UeState, error) {
+		switch prev {
+		case UeStateConnected, UeStateReleasing, UeStateHandoverExecuting:
+			return s.idleOr(ue, prev), nil
+		default:
+			// a procedure is adding PDU Sessions
+			return prev, nil
+		}
+	})
+}
+
+// get state of every UE
+func (s *PduSessions) UeStates(c *gin.Context) {
+	s.ueLock.Lock()
+	machines := make([]*ueStateMachine, 0, len(s.ueStates))
+	for _, m := range s.ueStates {
+		machines = append(machines, m)
+	}
+	s.ueLock.Unlock()
+	res := make([]UeStatus, len(machines))
+	for i, m := range machines {
+		m.Lock()
+		res[i] = m.status
+		m.Unlock()
+	}
+	c.Header("Cache-Control", "no-cache")
+	c.JSON(http.StatusOK, res)
+}
@@ -0,0 +1,111 @@
+// Copyright Louis Royer and the NextMN contributors. All rights reserved.
+// Use of this source code is governed by a MIT-style license that can be
+// found in the LICENSE file.
+// SPDX-License-Identifier: MIT
+
+package session
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/nextmn/json-api/jsonapi"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+func (s *PduSessions) XnHandoverRequest(c *gin.Context) {
+	var ps XnHandoverRequest
+	if err := c.BindJSON(&ps); err != nil {
+		logrus.WithError(err).Error("could not deserialize")
+		c.JSON(http.StatusBadRequest, jsonapi.MessageWithError{Message: "could not deserialize", Error: err})
+		return
+	}
+	logrus.WithFields(logrus.Fields{
+		"ue":         ps.UeCtrl.String(),
+		"source-gnb": ps.SourcegNB.String(),
+	}).Info("New Xn Handover Request")
+	s.StartProcedure(c, ps.UeCtrl, ProcHandoverRequest, func(ctx context.Context, prev UeState) (UeState, error) {
+		if err := s.HandleXnHandoverRequest(ctx, ps); err != nil {
+			return s.idleOr(ps.UeCtrl, prev), err
+		}
+		return UeStateHandoverExecuting, nil
+	})
+}
+
+// Xn Handover Request is send to the target gNB by the source gNB.
+// Upon receiving an Xn Handover Request, the target gNB allocates DL FTEIDs,
+// and send them within an Xn Handover Request Ack to the source gNB
+// (or an Handover Preparation Failure when PDU Sessions cannot be allocated).
+// The DL FTEIDs are also used by the source gNB to forward DL traffic directly to the target gNB.
+// The Path Switch Request is sent to the Control Plane once the Handover Confirm is received from the UE.
+func (s *PduSessions) HandleXnHandoverRequest(ctx context.Context, ps XnHandoverRequest) error {
+
+	// forwarded DL packets are buffered until the UE joins
+	s.manager.BufferDownlink(ps.UeCtrl)
+
+	// allocate DL FTEIDs
+	rsp_sessions := make([]Session, len(ps.Sessions))
+	copy(rsp_sessions, ps.Sessions)
+	for i, session := range ps.Sessions {
+		// allocate DL FTEID, and configure UL FTEID
+		pduSession, err := s.manager.NewPduSession(ctx, ps.UeCtrl, session)
+		if err != nil {
+			logrus.WithError(err).Error("Could create PDU Session")
+			s.rollbackHandover(ps.UeCtrl, rsp_sessions[:i])
+			s.sendXnHandoverPreparationFailure(ctx, ps, err.Error())
+			return err
+		}
+		rsp_sessions[i].DownlinkFteid = pduSession.DownlinkFteid
+		rsp_sessions[i].ForwardDownlinkFteid = pduSession.DownlinkFteid
+		rsp_sessions[i].PduSessionId = pduSession.PduSessionId
+		// DL traffic from the direct path is held until forwarded DL traffic is finished
+		if err := s.manager.AwaitEndMarker(pduSession.DownlinkFteid.Teid); err != nil {
+			logrus.WithError(err).Error("Could not wait for End Marker")
+		}
+	}
+
+	// the Path Switch Request will be sent when the UE joins
+	s.addHandover(targetHandover{
+		Xn:        true,
+		UeCtrl:    ps.UeCtrl,
+		Cp:        ps.Cp,
+		SourcegNB: ps.SourcegNB,
+		TargetgNB: ps.TargetgNB,
+		Sessions:  rsp_sessions,
+	})
+
+	// reply to source gNB
+	rsp := XnHandoverRequestAck{
+		// Header
+		UeCtrl:    ps.UeCtrl,
+		Cp:        ps.Cp,
+		TargetgNB: ps.TargetgNB,
+		// Xn Handover Request Ack
+		SourcegNB: ps.SourcegNB,
+		Sessions:  rsp_sessions,
+	}
+	if err := s.Client.Post(ctx, ps.SourcegNB, "xn/handover-request-ack", rsp); err != nil {
+		logrus.WithError(err).Error("Could not send xn/handover-request-ack")
+		return err
+	}
+	return nil
+}
+
+// Target gNB: resources for the Xn handover could not be allocated
+func (s *PduSessions) sendXnHandoverPreparationFailure(ctx context.Context, ps XnHandoverRequest, cause string) {
+	rsp := HandoverPreparationFailure{
+		// Header
+		UeCtrl:    ps.UeCtrl,
+		Cp:        ps.Cp,
+		SourcegNB: ps.SourcegNB,
+		// Handover Preparation Failure
+		TargetgNB: ps.TargetgNB,
+		Cause:     cause,
+	}
+	if err := s.Client.Post(ctx, ps.SourcegNB, "xn/handover-preparation-failure", rsp); err != nil {
+		logrus.WithError(err).Error("Could not send xn/handover-preparation-failure")
+		return
+	}
+}
@@ -0,0 +1,69 @@
+// Copyright Louis Royer and the NextMN contributors. All rights reserved.
+// Use of this source code is governed by a MIT-style license that can be
+// found in the LICENSE file.
+// SPDX-License-Identifier: MIT
+
+package session
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/nextmn/json-api/jsonapi"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+func (s *PduSessions) XnHandoverRequestAck(c *gin.Context) {
+	var ps XnHandoverRequestAck
+	if err := c.BindJSON(&ps); err != nil {
+		logrus.WithError(err).Error("could not deserialize")
+		c.JSON(http.StatusBadRequest, jsonapi.MessageWithError{Message: "could not deserialize", Error: err})
+		return
+	}
+	logrus.WithFields(logrus.Fields{
+		"ue":         ps.UeCtrl.String(),
+		"target-gnb": ps.TargetgNB.String(),
+	}).Info("New Xn Handover Request Ack")
+	s.StartProcedure(c, ps.UeCtrl, ProcXnHandoverRequestAck, func(ctx context.Context, _ UeState) (UeState, error) {
+		if err := s.HandleXnHandoverRequestAck(ctx, ps); err != nil {
+			// handover has been cancelled
+			return UeStateConnected, err
+		}
+		return UeStateHandoverExecuting, nil
+	})
+}
+
+// Xn Handover Request Ack is send to the source gNB by the target gNB.
+// Upon receiving an Xn Handover Request Ack, the source gNB sends the SN Status Transfer to the target gNB,
+// configures forwarding of DL traffic to the target gNB, and sends the Handover Command to the UE.
+func (s *PduSessions) HandleXnHandoverRequestAck(ctx context.Context, ps XnHandoverRequestAck) error {
+
+	// SN Status is transferred before DL traffic is forwarded
+	status := XnSnStatusTransfer{
+		// Header
+		UeCtrl:    ps.UeCtrl,
+		SourcegNB: ps.SourcegNB,
+		// SN Status Transfer
+		TargetgNB: ps.TargetgNB,
+		Sessions:  s.manager.SnStatus(ps.UeCtrl),
+	}
+	if err := s.Client.Post(ctx, ps.TargetgNB, "xn/sn-status-transfer", status); err != nil {
+		logrus.WithError(err).Error("Could not send xn/sn-status-transfer")
+	}
+
+	if err := s.startForwarding(ps.UeCtrl, ps.Sessions); err != nil {
+		s.CancelHandover(ctx, ps.UeCtrl, ps.TargetgNB, true, err.Error())
+		return err
+	}
+	return s.sendHandoverCommand(ctx, HandoverCommand{
+		// Header
+		UeCtrl:    ps.UeCtrl,
+		Cp:        ps.Cp,
+		SourceGnb: ps.SourcegNB,
+		// Handover Command
+		Sessions:  ps.Sessions,
+		TargetGnb: ps.TargetgNB,
+	})
+}
@@ -0,0 +1,36 @@
+// Copyright Louis Royer and the NextMN contributors. All rights reserved.
+// Use of this source code is governed by a MIT-style license that can be
+// found in the LICENSE file.
+// SPDX-License-Identifier: MIT
+
+package session
+
+import (
+	"net/http"
+
+	"github.com/nextmn/json-api/jsonapi"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+// SN Status Transfer is send to the target gNB by the source gNB.
+// gNB-Lite has no PDCP: SN Status is only logged.
+func (s *PduSessions) XnSnStatusTransfer(c *gin.Context) {
+	var ps XnSnStatusTransfer
+	if err := c.BindJSON(&ps); err != nil {
+		logrus.WithError(err).Error("could not deserialize")
+		c.JSON(http.StatusBadRequest, jsonapi.MessageWithError{Message: "could not deserialize", Error: err})
+		return
+	}
+	for _, status := range ps.Sessions {
+		logrus.WithFields(logrus.Fields{
+			"ue":             ps.UeCtrl.String(),
+			"source-gnb":     ps.SourcegNB.String(),
+			"pdu-session-id": status.PduSessionId,
+			"ul-count":       status.UlCount,
+			"dl-count":       status.DlCount,
+		}).Info("New SN Status Transfer")
+	}
+	c.JSON(http.StatusAccepted, jsonapi.Message{Message: "please refer to logs for more information"})
+}
@@ -0,0 +1,47 @@
+// Copyright Louis Royer and the NextMN contributors. All rights reserved.
+// Use of this source code is governed by a MIT-style license that can be
+// found in the LICENSE file.
+// SPDX-License-Identifier: MIT
+
+package session
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/nextmn/json-api/jsonapi"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+func (s *PduSessions) XnUeContextRelease(c *gin.Context) {
+	var ps XnUeContextRelease
+	if err := c.BindJSON(&ps); err != nil {
+		logrus.WithError(err).Error("could not deserialize")
+		c.JSON(http.StatusBadRequest, jsonapi.MessageWithError{Message: "could not deserialize", Error: err})
+		return
+	}
+	logrus.WithFields(logrus.Fields{
+		"ue":         ps.UeCtrl.String(),
+		"target-gnb": ps.TargetgNB.String(),
+	}).Info("New UE Context Release")
+	s.StartProcedure(c, ps.UeCtrl, ProcUeContextRelease, func(_ context.Context, prev UeState) (UeState, error) {
+		s.HandleXnUeContextRelease(ps)
+		// PDU Sessions still forwarding DL traffic are removed later
+		return s.idleOr(ps.UeCtrl, prev), nil
+	})
+}
+
+// UE Context Release is send to the source gNB by the target gNB, once the path switch is done.
+// Upon receiving UE Context Release, the source gNB removes PDU Sessions of the UE.
+// PDU Sessions still forwarding DL traffic are removed with a timer,
+// or earlier if an End Marker is received.
+func (s *PduSessions) HandleXnUeContextRelease(ps XnUeContextRelease) {
+	for _, session := range s.manager.ReleaseSourcePduSessions(ps.UeCtrl) {
+		logrus.WithFields(logrus.Fields{
+			"ue":             ps.UeCtrl.String(),
+			"pdu-session-id": session.PduSessionId,
+		}).Info("Source PDU Session released")
+	}
+}